@@ -0,0 +1,122 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ConflictError is returned by CompareAndSwap when the entry does not have the expected version.
+type ConflictError struct {
+	CacheKey string
+	// Expected is the version passed to CompareAndSwap.
+	Expected string
+	// Actual is the current version of the entry, or empty if it does not exist.
+	Actual string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("cache entry %q changed: expected version %q, found %q", e.CacheKey, e.Expected, e.Actual)
+}
+
+// ReadWithVersion returns the cached value for `cacheKey` together with the version of the entry,
+// which can be passed to CompareAndSwap. The version is the hex encoded SHA-256 of the encoded value
+// and can also be used as an ETag. ErrNotCached is returned if there is no fresh entry.
+func ReadWithVersion[T any](cacheKey string, cacheDir string, opts ...Option) (T, string, error) {
+	var data T
+	o := newOptionsFor[T](opts)
+	if o.err != nil {
+		return data, "", o.err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	info, err := statEntry(cacheFilePath, o)
+	if err != nil || !isFresh(info, o.ttl) {
+		return data, "", ErrNotCached
+	}
+	fileData, err := readEntry(cacheFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, "", ErrNotCached
+	}
+	if err != nil {
+		return data, "", fmt.Errorf("error reading cache file: %w", err)
+	}
+	if err := json.Unmarshal(fileData, &data); err != nil {
+		return data, "", fmt.Errorf("error parsing cache file JSON: %w", err)
+	}
+	return data, sha256Hex(fileData), nil
+}
+
+// CompareAndSwap stores `newValue` for `cacheKey` if the entry still has `expectedVersion`,
+// as returned by ReadWithVersion. An empty expectedVersion requires the entry not to exist or to
+// have expired. Otherwise a *ConflictError is returned and the entry is left unchanged. Only the
+// comparison and the atomic write happen under the entry lock, not the computation of the new value.
+// The lock is taken with the configured Locker, or with a LockFileLocker if none is configured
+// (see WithLocker), so concurrent swaps of the same version never both succeed. The new version
+// is returned.
+func CompareAndSwap[T any](cacheKey string, cacheDir string, expectedVersion string, newValue T, opts ...Option) (string, error) {
+	o := newOptionsFor[T](opts)
+	if o.err != nil {
+		return "", o.err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	dataBytes, err := json.Marshal(newValue)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling data to JSON: %w", err)
+	}
+
+	unlock, err := lockEntryExclusive(context.Background(), cacheFilePath, o)
+	if err != nil {
+		return "", fmt.Errorf("error locking cache entry: %w", err)
+	}
+	defer unlock()
+
+	actual, err := entryVersion(cacheFilePath, o)
+	if err != nil {
+		return "", fmt.Errorf("error reading cache file: %w", err)
+	}
+	if actual != expectedVersion {
+		return "", &ConflictError{CacheKey: cacheKey, Expected: expectedVersion, Actual: actual}
+	}
+
+	if err := writeEntry(cacheKey, cacheFilePath, dataBytes, o); err != nil {
+		return "", fmt.Errorf("error writing cache file: %w", err)
+	}
+	o.trackExpiry(cacheKey, cacheFilePath)
+
+	return sha256Hex(dataBytes), nil
+}
+
+// entryVersion returns the version of the entry at path, or an empty string if it does not exist
+// or is no longer fresh, in line with ReadWithVersion. Chunked entries take the version from their
+// manifest instead of reading all chunks.
+func entryVersion(path string, o *options) (string, error) {
+	info, err := statEntry(path, o)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !isFresh(info, o.ttl)) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	fileData, err := os.ReadFile(path)
+	if err == nil {
+		return sha256Hex(fileData), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	m, err := readManifest(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return m.SHA256, nil
+}
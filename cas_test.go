@@ -0,0 +1,108 @@
+package get_with_cache_go
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	dir := t.TempDir()
+
+	v1, err := CompareAndSwap("key", dir, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompareAndSwap("key", dir, "", 2); !isConflict(err, v1) {
+		t.Fatalf("create over an existing entry: got %v", err)
+	}
+
+	got, version, err := ReadWithVersion[int]("key", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 || version != v1 {
+		t.Fatalf("got %d at version %q, want 1 at %q", got, version, v1)
+	}
+
+	v2, err := CompareAndSwap("key", dir, v1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompareAndSwap("key", dir, v1, 3); !isConflict(err, v2) {
+		t.Fatalf("swap from a stale version: got %v", err)
+	}
+	if got, _, _ := ReadWithVersion[int]("key", dir); got != 2 {
+		t.Fatalf("conflicting swap changed the entry to %d", got)
+	}
+}
+
+func TestCompareAndSwapChunked(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithChunkSize(8)}
+	v1, err := CompareAndSwap("key", dir, "", "a value spanning several chunks", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, version, err := ReadWithVersion[string]("key", dir, opts...); err != nil || version != v1 {
+		t.Fatalf("got version %q, %v, want %q", version, err, v1)
+	}
+	if _, err := CompareAndSwap("key", dir, v1, "another value", opts...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareAndSwapExpiredEntry(t *testing.T) {
+	dir := t.TempDir()
+	ttl := WithTTL(20 * time.Millisecond)
+	if _, err := CompareAndSwap("key", dir, "", 1, ttl); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// An expired entry is not cached for ReadWithVersion, so it can be created again
+	if _, _, err := ReadWithVersion[int]("key", dir, ttl); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("got %v, want %v", err, ErrNotCached)
+	}
+	if _, err := CompareAndSwap("key", dir, "", 2, ttl); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	version, err := CompareAndSwap("key", dir, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without WithLocker, exactly one of the swaps from the same version succeeds
+	var succeeded atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := CompareAndSwap("key", dir, version, i+1)
+			var conflict *ConflictError
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case !errors.As(err, &conflict):
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := succeeded.Load(); got != 1 {
+		t.Fatalf("%d swaps succeeded, want 1", got)
+	}
+}
+
+func isConflict(err error, actual string) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict) && conflict.Actual == actual
+}
@@ -0,0 +1,267 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxParallelChunkReads limits the number of chunk files read concurrently.
+	maxParallelChunkReads = 8
+	// chunkLockRetryInterval is how often a waiting chunk writer retries the chunk lock.
+	chunkLockRetryInterval = 5 * time.Millisecond
+)
+
+// chunkManifest describes an entry whose payload is split into fixed-size chunks.
+// Chunks[i] is the hex encoded SHA-256 of the i-th chunk. The chunks are stored in the
+// Generation subdirectory of the chunk directory, so that a new version never overwrites
+// the chunks of the version a concurrent reader is using.
+type chunkManifest struct {
+	Size      int64    `json:"size"`
+	ChunkSize int64    `json:"chunkSize"`
+	SHA256    string   `json:"sha256"`
+	Chunks    []string `json:"chunks"`
+	// Generation is local to a cache directory, exported manifests leave it out.
+	Generation string `json:"generation,omitempty"`
+}
+
+func manifestPath(path string) string {
+	return path + ".manifest"
+}
+
+func chunkDir(path string) string {
+	return path + ".chunks"
+}
+
+func chunkLockPath(path string) string {
+	return chunkDir(path) + ".lock"
+}
+
+func generationDir(path string, m *chunkManifest) string {
+	return filepath.Join(chunkDir(path), m.Generation)
+}
+
+func chunkPath(path string, m *chunkManifest, i int) string {
+	return filepath.Join(generationDir(path, m), fmt.Sprintf("%06d", i))
+}
+
+func readManifest(path string) (*chunkManifest, error) {
+	manifestData, err := os.ReadFile(manifestPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var m chunkManifest
+	if err := json.Unmarshal(manifestData, &m); err != nil {
+		return nil, fmt.Errorf("error parsing chunk manifest: %w", err)
+	}
+	if !m.valid() {
+		return nil, fmt.Errorf("invalid chunk manifest %s", manifestPath(path))
+	}
+	return &m, nil
+}
+
+// valid reports whether the number of chunks matches the size of the payload.
+func (m *chunkManifest) valid() bool {
+	return m.Size >= 0 && m.ChunkSize > 0 && int64(len(m.Chunks)) == (m.Size+m.ChunkSize-1)/m.ChunkSize
+}
+
+// readChunks reads length bytes of a chunked payload starting at offset, reading the
+// chunks involved in parallel. Chunks that are read completely are verified against
+// their checksum.
+func readChunks(path string, m *chunkManifest, offset int64, length int64) ([]byte, error) {
+	buf := make([]byte, length)
+	if length == 0 {
+		return buf, nil
+	}
+
+	first := int(offset / m.ChunkSize)
+	last := int((offset + length - 1) / m.ChunkSize)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallelChunkReads)
+	errs := make([]error, last-first+1)
+	for i := first; i <= last; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			chunkStart := int64(i) * m.ChunkSize
+			chunkEnd := min(chunkStart+m.ChunkSize, m.Size)
+			from := max(offset, chunkStart)
+			to := min(offset+length, chunkEnd)
+			dst := buf[from-offset : to-offset]
+			if err := readChunk(chunkPath(path, m, i), from-chunkStart, dst); err != nil {
+				errs[i-first] = fmt.Errorf("error reading chunk %d: %w", i, err)
+				return
+			}
+			if from == chunkStart && to == chunkEnd && sha256Hex(dst) != m.Chunks[i] {
+				errs[i-first] = fmt.Errorf("chunk %d checksum mismatch", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func readChunk(path string, offset int64, dst []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := f.ReadAt(dst, offset)
+	if n == len(dst) {
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeChunks stores data as chunks of chunkSize bytes followed by their manifest.
+// The chunks go to a generation directory named after the payload checksum, so chunks
+// already on disk from an interrupted write of the same payload are kept and the write
+// resumes where it stopped. The manifest is written last, which makes the new version
+// visible to readers, and the previous generations are removed afterwards.
+func writeChunks(path string, data []byte, chunkSize int64) error {
+	m := chunkManifest{
+		Size:      int64(len(data)),
+		ChunkSize: chunkSize,
+		SHA256:    sha256Hex(data),
+	}
+	for start := int64(0); start < m.Size; start += chunkSize {
+		m.Chunks = append(m.Chunks, sha256Hex(data[start:min(start+chunkSize, m.Size)]))
+	}
+
+	w, err := newChunkWriter(path, m)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+	for i := range m.Chunks {
+		start := int64(i) * chunkSize
+		if err := w.writeChunk(i, data[start:min(start+chunkSize, m.Size)]); err != nil {
+			return err
+		}
+	}
+	return w.commit()
+}
+
+// chunkWriter writes the chunks of a new version of a chunked entry into a fresh generation
+// directory and switches the manifest to it once all chunks are written. Writers of the same
+// entry are serialized by a lock file next to the chunk directory, whatever Locker is configured,
+// as committing a version removes the generations of all others.
+type chunkWriter struct {
+	path   string
+	m      chunkManifest
+	unlock func() error
+}
+
+// newChunkWriter takes the chunk lock of the entry at path and prepares writing the chunks
+// described by m, whose Generation is derived from the payload checksum. The writer must be
+// closed.
+func newChunkWriter(path string, m chunkManifest) (*chunkWriter, error) {
+	if len(m.SHA256) < 16 {
+		return nil, fmt.Errorf("invalid payload checksum %q", m.SHA256)
+	}
+	m.Generation = m.SHA256[:16]
+
+	unlock, err := LockFileLocker{RetryInterval: chunkLockRetryInterval}.Lock(context.Background(), chunkLockPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error locking chunks: %w", err)
+	}
+	if err := os.MkdirAll(generationDir(path, &m), 0755); err != nil {
+		unlock()
+		return nil, err
+	}
+	return &chunkWriter{path: path, m: m, unlock: unlock}, nil
+}
+
+// close releases the chunk lock. Chunks written without commit stay invisible to readers
+// and are removed by the next commit.
+func (w *chunkWriter) close() error {
+	return w.unlock()
+}
+
+// writeChunk stores the i-th chunk after checking it against the manifest. A chunk left
+// with the same content by a previous attempt is kept as is.
+func (w *chunkWriter) writeChunk(i int, chunk []byte) error {
+	if i < 0 || i >= len(w.m.Chunks) {
+		return fmt.Errorf("chunk %d out of range", i)
+	}
+	if sha256Hex(chunk) != w.m.Chunks[i] {
+		return fmt.Errorf("chunk %d checksum mismatch", i)
+	}
+
+	p := chunkPath(w.path, &w.m, i)
+	if existing, err := os.ReadFile(p); err == nil && bytes.Equal(existing, chunk) {
+		return nil
+	}
+	return writeFileAtomic(p, chunk)
+}
+
+// commit writes the manifest, making the new version visible, and removes the chunks of
+// the previous versions.
+func (w *chunkWriter) commit() error {
+	manifestData, err := json.Marshal(w.m)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(manifestPath(w.path), manifestData); err != nil {
+		return err
+	}
+	return removeStaleGenerations(w.path, w.m.Generation)
+}
+
+// removeStaleGenerations deletes everything in the chunk directory of the entry at path
+// but the given generation. A reader still using a removed generation fails and retries
+// with the current manifest.
+func removeStaleGenerations(path string, generation string) error {
+	entries, err := os.ReadDir(chunkDir(path))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == generation || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(chunkDir(path), e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeChunks deletes the manifest and chunks of the entry at path, if any.
+func removeChunks(path string) error {
+	if err := os.Remove(manifestPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(chunkDir(path))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
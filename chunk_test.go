@@ -0,0 +1,187 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestChunkedEntryRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	value := strings.Repeat("0123456789", 20)
+	fetches := 0
+	getData := func() (string, error) {
+		fetches++
+		return value, nil
+	}
+
+	for range 2 {
+		got, err := FetchDataWithCache(getData, "key", dir, WithChunkSize(16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != value {
+			t.Fatalf("got %q, want %q", got, value)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("getDataFunc called %d times, want 1", fetches)
+	}
+
+	path := filepath.Join(dir, "key.json")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("single-file entry exists next to the manifest: %v", err)
+	}
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (m.Size + 15) / 16; int64(len(m.Chunks)) != want {
+		t.Fatalf("got %d chunks, want %d", len(m.Chunks), want)
+	}
+}
+
+func TestReadCacheRange(t *testing.T) {
+	for _, chunkSize := range []int64{0, 7} {
+		dir := t.TempDir()
+		if _, err := CompareAndSwap("key", dir, "", "abcdefghijklmnopqrstuvwxyz", WithChunkSize(chunkSize)); err != nil {
+			t.Fatal(err)
+		}
+		encoded := `"abcdefghijklmnopqrstuvwxyz"`
+
+		tests := []struct {
+			offset, length int64
+			want           string
+		}{
+			{0, 5, encoded[:5]},
+			{5, 10, encoded[5:15]},
+			{6, 8, encoded[6:14]},
+			{20, 100, encoded[20:]},
+			{int64(len(encoded)), 3, ""},
+			{100, 3, ""},
+		}
+		for _, tt := range tests {
+			got, err := ReadCacheRange("key", dir, tt.offset, tt.length, WithChunkSize(chunkSize))
+			if err != nil {
+				t.Fatalf("chunk size %d, range %d+%d: %v", chunkSize, tt.offset, tt.length, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("chunk size %d, range %d+%d: got %q, want %q", chunkSize, tt.offset, tt.length, got, tt.want)
+			}
+		}
+
+		if _, err := ReadCacheRange("key", dir, -1, 3); err == nil {
+			t.Errorf("chunk size %d: negative offset accepted", chunkSize)
+		}
+	}
+}
+
+func TestWriteChunksReplacesGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	first := bytes.Repeat([]byte("a"), 100)
+	second := bytes.Repeat([]byte("b"), 250)
+
+	if err := writeChunks(path, first, 30); err != nil {
+		t.Fatal(err)
+	}
+	old, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeChunks(path, second, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reader still holding the old manifest fails instead of mixing versions,
+	// while a new read gets the new version
+	if _, err := readChunks(path, old, 0, old.Size); err == nil {
+		t.Fatal("read of a removed generation succeeded")
+	}
+	got, err := readEntry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, second) {
+		t.Fatalf("got %d bytes of the wrong version", len(got))
+	}
+
+	generations, err := os.ReadDir(chunkDir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generations) != 1 {
+		t.Fatalf("got %d generations, want 1", len(generations))
+	}
+}
+
+func TestReadChunksDetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := writeChunks(path, bytes.Repeat([]byte("a"), 100), 30); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(chunkPath(path, m, 1), bytes.Repeat([]byte("b"), 30), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readEntry(path); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("got %v, want a checksum mismatch", err)
+	}
+}
+
+func TestConcurrentChunkedWrites(t *testing.T) {
+	dir := t.TempDir()
+	o := newOptions([]Option{WithChunkSize(64)})
+	for round := range 5 {
+		path := filepath.Join(dir, fmt.Sprintf("key-%d.json", round))
+		var wg sync.WaitGroup
+		for i := range 4 {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				data := []byte(strconv.Quote(strings.Repeat(strconv.Itoa(i), 4096)))
+				if err := writeEntry("", path, data, o); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Whichever writer won, the entry must be complete
+		if _, err := readEntry(path); err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+	}
+}
+
+func TestMissingChunkIsCacheMiss(t *testing.T) {
+	dir := t.TempDir()
+	value := strings.Repeat("x", 100)
+	if _, err := CompareAndSwap("key", dir, "", value, WithChunkSize(16)); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "key.json")
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(chunkPath(path, m, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FetchDataWithCache(func() (string, error) { return "fetched", nil }, "key", dir, WithChunkSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "fetched" {
+		t.Fatalf("got %q, want the value fetched again", got)
+	}
+}
@@ -0,0 +1,101 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCached is returned by context-aware fetches in CacheModeOnlyIfCached mode
+// when no usable cache entry exists.
+var ErrNotCached = errors.New("entry not cached")
+
+// CacheMode controls how a context-aware fetch uses the cache.
+type CacheMode int
+
+const (
+	// CacheModeDefault serves cached entries and stores fetched data.
+	CacheModeDefault CacheMode = iota
+	// CacheModeNoCache ignores cached entries, fetches the data and stores it.
+	CacheModeNoCache
+	// CacheModeNoStore neither reads nor writes the cache.
+	CacheModeNoStore
+	// CacheModeOnlyIfCached serves cached entries and fails with ErrNotCached instead of fetching.
+	CacheModeOnlyIfCached
+)
+
+// Directives are per-request cache directives carried by a context.Context.
+type Directives struct {
+	Mode CacheMode
+	// MaxAge, if positive, makes cached entries older than MaxAge count as missing.
+	MaxAge time.Duration
+}
+
+type directivesKey struct{}
+
+// WithDirectives returns a copy of ctx carrying the cache directives d.
+func WithDirectives(ctx context.Context, d Directives) context.Context {
+	return context.WithValue(ctx, directivesKey{}, d)
+}
+
+// DirectivesFromContext returns the cache directives carried by ctx,
+// or the zero Directives if there are none.
+func DirectivesFromContext(ctx context.Context) Directives {
+	d, _ := ctx.Value(directivesKey{}).(Directives)
+	return d
+}
+
+// CacheControlMiddleware maps the Cache-Control (or legacy Pragma) header of incoming requests
+// to Directives attached to the request context, so that FetchDataWithCacheContext calls
+// made while handling the request honour them.
+func CacheControlMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Cache-Control")
+		if header == "" {
+			header = r.Header.Get("Pragma")
+		}
+		if d := parseCacheControl(header); d != (Directives{}) {
+			r = r.WithContext(WithDirectives(r.Context(), d))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseCacheControl converts request Cache-Control directives to Directives.
+func parseCacheControl(header string) Directives {
+	var d Directives
+	var noCache, noStore, onlyIfCached bool
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		case "only-if-cached":
+			onlyIfCached = true
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			if seconds == 0 {
+				noCache = true
+			}
+			d.MaxAge = time.Duration(seconds) * time.Second
+		}
+	}
+
+	switch {
+	case onlyIfCached:
+		d.Mode = CacheModeOnlyIfCached
+	case noStore:
+		d.Mode = CacheModeNoStore
+	case noCache:
+		d.Mode = CacheModeNoCache
+	}
+	return d
+}
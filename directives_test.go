@@ -0,0 +1,64 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Directives
+	}{
+		{"", Directives{}},
+		{"no-cache", Directives{Mode: CacheModeNoCache}},
+		{"No-Store", Directives{Mode: CacheModeNoStore}},
+		{"no-cache, no-store", Directives{Mode: CacheModeNoStore}},
+		{"only-if-cached, no-store", Directives{Mode: CacheModeOnlyIfCached}},
+		{"max-age=60", Directives{MaxAge: time.Minute}},
+		{`max-age="30"`, Directives{MaxAge: 30 * time.Second}},
+		{"max-age=0", Directives{Mode: CacheModeNoCache}},
+		{"max-age=-1", Directives{}},
+		{"max-age=soon", Directives{}},
+		{" max-age=10 , only-if-cached ", Directives{Mode: CacheModeOnlyIfCached, MaxAge: 10 * time.Second}},
+		{"private, must-revalidate", Directives{}},
+	}
+	for _, tt := range tests {
+		if got := parseCacheControl(tt.header); got != tt.want {
+			t.Errorf("parseCacheControl(%q) = %+v, want %+v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestFetchDataWithCacheContextDirectives(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	getData := func() (int, error) {
+		calls++
+		return calls, nil
+	}
+	fetch := func(d Directives) (int, error) {
+		return FetchDataWithCacheContext(WithDirectives(context.Background(), d), getData, "key", dir)
+	}
+
+	if _, err := fetch(Directives{Mode: CacheModeOnlyIfCached}); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("only-if-cached on a miss: got %v, want %v", err, ErrNotCached)
+	}
+	if got, err := fetch(Directives{Mode: CacheModeNoStore}); err != nil || got != 1 {
+		t.Fatalf("no-store: got %d, %v", got, err)
+	}
+	if got, err := fetch(Directives{}); err != nil || got != 2 {
+		t.Fatalf("no-store stored its value: got %d, %v", got, err)
+	}
+	if got, err := fetch(Directives{Mode: CacheModeOnlyIfCached}); err != nil || got != 2 {
+		t.Fatalf("only-if-cached on a hit: got %d, %v", got, err)
+	}
+	if got, err := fetch(Directives{Mode: CacheModeNoCache}); err != nil || got != 3 {
+		t.Fatalf("no-cache: got %d, %v", got, err)
+	}
+	if got, err := fetch(Directives{}); err != nil || got != 3 {
+		t.Fatalf("no-cache did not store its value: got %d, %v", got, err)
+	}
+}
@@ -0,0 +1,180 @@
+package get_with_cache_go
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// ExpiryHooks are the callbacks run by an ExpiryScheduler. They are called from the scheduler's
+// goroutine, one at a time, so slow hooks delay the following ones.
+type ExpiryHooks struct {
+	// LeadTime is how long before the expiry of an entry OnNearExpiry is called.
+	LeadTime time.Duration
+	// OnNearExpiry, if set, is called LeadTime before an entry expires.
+	OnNearExpiry func(cacheKey string, expiresAt time.Time)
+	// OnExpire, if set, is called when an entry expires.
+	OnExpire func(cacheKey string, expiresAt time.Time)
+}
+
+// ExpiryScheduler calls ExpiryHooks when tracked entries are about to expire and when they expire.
+// Entries are tracked by the fetch functions given WithExpiryScheduler and WithTTL, whenever they
+// are written or served. Pending events are kept in a min-heap served by a single timer, so no
+// cache files are polled.
+type ExpiryScheduler struct {
+	hooks ExpiryHooks
+
+	mu       sync.Mutex
+	events   expiryEvents
+	expiries map[string]time.Time
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewExpiryScheduler starts an ExpiryScheduler calling hooks. Call Stop to release it.
+func NewExpiryScheduler(hooks ExpiryHooks) *ExpiryScheduler {
+	s := &ExpiryScheduler{
+		hooks:    hooks,
+		expiries: map[string]time.Time{},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// WithExpiryScheduler makes fetches track the expiry of entries in s. It has no effect without WithTTL.
+func WithExpiryScheduler(s *ExpiryScheduler) Option {
+	return func(o *options) {
+		o.expiryScheduler = s
+	}
+}
+
+// Track schedules the hooks for cacheKey expiring at expiresAt, replacing earlier schedules of cacheKey.
+func (s *ExpiryScheduler) Track(cacheKey string, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.expiries[cacheKey]; ok && current.Equal(expiresAt) {
+		return
+	}
+	s.expiries[cacheKey] = expiresAt
+	if s.hooks.OnNearExpiry != nil && s.hooks.LeadTime > 0 {
+		heap.Push(&s.events, expiryEvent{at: expiresAt.Add(-s.hooks.LeadTime), cacheKey: cacheKey, expiresAt: expiresAt, near: true})
+	}
+	heap.Push(&s.events, expiryEvent{at: expiresAt, cacheKey: cacheKey, expiresAt: expiresAt})
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Untrack cancels the pending hooks for cacheKey.
+func (s *ExpiryScheduler) Untrack(cacheKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expiries, cacheKey)
+}
+
+// Stop stops the scheduler. Pending hooks are not called.
+func (s *ExpiryScheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *ExpiryScheduler) run() {
+	defer close(s.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		for _, e := range s.due() {
+			if e.near {
+				s.hooks.OnNearExpiry(e.cacheKey, e.expiresAt)
+			} else if s.hooks.OnExpire != nil {
+				s.hooks.OnExpire(e.cacheKey, e.expiresAt)
+			}
+		}
+
+		timer.Reset(s.nextWait())
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// due pops the events that are due and still current.
+func (s *ExpiryScheduler) due() []expiryEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []expiryEvent
+	now := time.Now()
+	for len(s.events) > 0 && !s.events[0].at.After(now) {
+		e := heap.Pop(&s.events).(expiryEvent)
+		// Skip events of entries that were rescheduled or untracked
+		if current, ok := s.expiries[e.cacheKey]; !ok || !current.Equal(e.expiresAt) {
+			continue
+		}
+		if !e.near {
+			delete(s.expiries, e.cacheKey)
+		}
+		due = append(due, e)
+	}
+	return due
+}
+
+func (s *ExpiryScheduler) nextWait() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.events) == 0 {
+		return time.Hour
+	}
+	return max(time.Until(s.events[0].at), 0)
+}
+
+// trackExpiry tracks the entry at path in the configured ExpiryScheduler, if any.
+func (o *options) trackExpiry(cacheKey string, path string) {
+	if o.expiryScheduler == nil || o.ttl <= 0 {
+		return
+	}
+	if info, err := statEntry(path, o); err == nil {
+		o.expiryScheduler.Track(cacheKey, info.ModTime().Add(o.ttl))
+	}
+}
+
+// untrackExpiry stops tracking cacheKey in the configured ExpiryScheduler, if any.
+func (o *options) untrackExpiry(cacheKey string) {
+	if o.expiryScheduler != nil {
+		o.expiryScheduler.Untrack(cacheKey)
+	}
+}
+
+type expiryEvent struct {
+	at        time.Time
+	cacheKey  string
+	expiresAt time.Time
+	near      bool
+}
+
+// expiryEvents is a min-heap of events ordered by time, implementing heap.Interface.
+type expiryEvents []expiryEvent
+
+func (h expiryEvents) Len() int           { return len(h) }
+func (h expiryEvents) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h expiryEvents) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryEvents) Push(x any)        { *h = append(*h, x.(expiryEvent)) }
+func (h *expiryEvents) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
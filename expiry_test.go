@@ -0,0 +1,90 @@
+package get_with_cache_go
+
+import (
+	"testing"
+	"time"
+)
+
+type expiryCall struct {
+	hook      string
+	cacheKey  string
+	expiresAt time.Time
+}
+
+// recordingScheduler starts an ExpiryScheduler that sends its hook calls to the returned channel.
+func recordingScheduler(t *testing.T, leadTime time.Duration) (*ExpiryScheduler, <-chan expiryCall) {
+	calls := make(chan expiryCall, 10)
+	s := NewExpiryScheduler(ExpiryHooks{
+		LeadTime: leadTime,
+		OnNearExpiry: func(cacheKey string, expiresAt time.Time) {
+			calls <- expiryCall{"near", cacheKey, expiresAt}
+		},
+		OnExpire: func(cacheKey string, expiresAt time.Time) {
+			calls <- expiryCall{"expire", cacheKey, expiresAt}
+		},
+	})
+	t.Cleanup(s.Stop)
+	return s, calls
+}
+
+func TestExpirySchedulerOrder(t *testing.T) {
+	s, calls := recordingScheduler(t, 30*time.Millisecond)
+	now := time.Now()
+	a, b := now.Add(40*time.Millisecond), now.Add(80*time.Millisecond)
+	s.Track("b", b)
+	s.Track("a", a)
+
+	want := []expiryCall{{"near", "a", a}, {"expire", "a", a}, {"near", "b", b}, {"expire", "b", b}}
+	for i, w := range want {
+		got := waitFor(t, calls, w.hook+" "+w.cacheKey)
+		if got.hook != w.hook || got.cacheKey != w.cacheKey || !got.expiresAt.Equal(w.expiresAt) {
+			t.Fatalf("call %d: got %+v, want %+v", i, got, w)
+		}
+		if got.hook == "expire" && time.Now().Before(w.expiresAt) {
+			t.Errorf("%s expired early", w.cacheKey)
+		}
+	}
+}
+
+func TestExpirySchedulerUntrackAndReschedule(t *testing.T) {
+	s, calls := recordingScheduler(t, 0)
+	now := time.Now()
+	s.Track("untracked", now.Add(20*time.Millisecond))
+	s.Untrack("untracked")
+	s.Track("rescheduled", now.Add(20*time.Millisecond))
+	later := now.Add(60 * time.Millisecond)
+	s.Track("rescheduled", later)
+
+	got := waitFor(t, calls, "the rescheduled expiry")
+	if got != (expiryCall{"expire", "rescheduled", later}) {
+		t.Fatalf("got %+v", got)
+	}
+	select {
+	case got := <-calls:
+		t.Fatalf("unexpected call %+v", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestExpirySchedulerTracksFetches(t *testing.T) {
+	dir := t.TempDir()
+	s, calls := recordingScheduler(t, 0)
+	opts := []Option{WithTTL(50 * time.Millisecond), WithExpiryScheduler(s)}
+	for _, key := range []string{"kept", "invalidated"} {
+		if _, err := FetchDataWithCache(func() (int, error) { return 1, nil }, key, dir, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Invalidate("invalidated", dir, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := waitFor(t, calls, "the expiry"); got.hook != "expire" || got.cacheKey != "kept" {
+		t.Fatalf("got %+v", got)
+	}
+	select {
+	case got := <-calls:
+		t.Fatalf("unexpected call %+v", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,397 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportRecord is one line of the export format: an entry with its metadata and sidecar files,
+// or one chunk of a chunked entry.
+type exportRecord struct {
+	// Path is the slash separated path of the cache file relative to the cache directory.
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Data    []byte    `json:"data,omitempty"`
+	// Sidecars maps file name suffixes (".key", ".validator", ".idx-<name>") to file contents.
+	Sidecars map[string][]byte `json:"sidecars,omitempty"`
+	// Manifest is set for chunked entries, whose chunks follow in order as records of their own.
+	Manifest *chunkManifest `json:"manifest,omitempty"`
+	// Chunk is the index of the chunk held in Data by the records following a chunked entry.
+	Chunk *int `json:"chunk,omitempty"`
+}
+
+// ExportConfig configures Export, ExportHandler and Bootstrap.
+type ExportConfig struct {
+	// Limit, if positive, restricts the export to the Limit most recently written entries.
+	// Reads are not tracked, so these stand in for the hottest entries.
+	Limit int
+}
+
+// Export writes the entries in `cacheDir`, most recently written first, to w as JSON lines.
+// Each line holds the entry's path, modification time, SHA-256 checksum, payload and sidecar
+// files (key, validator and indexes). Chunked entries are written as their manifest followed by
+// one line per chunk, so that no entry is held in memory as a whole. The output can be read with
+// Import. It returns the number of exported entries.
+func Export(w io.Writer, cacheDir string, cfg ExportConfig) (int, error) {
+	type exportEntry struct {
+		path    string
+		modTime time.Time
+	}
+	var entries []exportEntry
+	err := walkEntries(cacheDir, func(entry string, _ string, info fs.FileInfo) error {
+		entries = append(entries, exportEntry{path: entry, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error listing cache directory: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.After(entries[j].modTime) })
+	if cfg.Limit > 0 && len(entries) > cfg.Limit {
+		entries = entries[:cfg.Limit]
+	}
+
+	enc := json.NewEncoder(w)
+	exported := 0
+	for _, e := range entries {
+		err := encodeEntry(enc, cacheDir, e.path, e.modTime)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed or rewritten since listing the directory, Import drops incomplete chunked entries
+			continue
+		}
+		if err != nil {
+			return exported, fmt.Errorf("error exporting cache entry %s: %w", e.path, err)
+		}
+		exported++
+	}
+	return exported, nil
+}
+
+// encodeEntry writes the records of the entry at path to enc.
+func encodeEntry(enc *json.Encoder, cacheDir string, path string, modTime time.Time) error {
+	rel, err := filepath.Rel(cacheDir, path)
+	if err != nil {
+		return err
+	}
+	rec := &exportRecord{
+		Path:    filepath.ToSlash(rel),
+		ModTime: modTime,
+	}
+	if rec.Sidecars, err = readSidecars(path); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		rec.SHA256 = sha256Hex(data)
+		rec.Data = data
+		return encodeRecord(enc, rec)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+	rec.SHA256 = m.SHA256
+	rec.Manifest = &chunkManifest{Size: m.Size, ChunkSize: m.ChunkSize, SHA256: m.SHA256, Chunks: m.Chunks}
+	if err := encodeRecord(enc, rec); err != nil {
+		return err
+	}
+	for i := range m.Chunks {
+		chunk, err := os.ReadFile(chunkPath(path, m, i))
+		if err != nil {
+			return err
+		}
+		if err := encodeRecord(enc, &exportRecord{Path: rec.Path, Data: chunk, Chunk: &i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeRecord writes rec to enc.
+func encodeRecord(enc *json.Encoder, rec *exportRecord) error {
+	if err := enc.Encode(rec); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	return nil
+}
+
+// readSidecars returns the key file, validator and indexes of the entry at path by file name suffix.
+func readSidecars(path string) (map[string][]byte, error) {
+	sidecars := map[string][]byte{}
+	indexes, _ := filepath.Glob(indexPath(path, "*"))
+	for _, sidecar := range append([]string{keyPath(path), validatorPath(path)}, indexes...) {
+		sidecarData, err := os.ReadFile(sidecar)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sidecars[strings.TrimPrefix(sidecar, path)] = sidecarData
+	}
+	return sidecars, nil
+}
+
+// Import reads entries written by Export from r into `cacheDir`, verifying their checksums.
+// Entries are written atomically with their original modification time, so their remaining
+// TTL is kept, and local entries written more recently are left untouched. Chunked entries are
+// written chunk by chunk as they are read and only become visible once complete. It returns the
+// number of imported entries.
+func Import(r io.Reader, cacheDir string) (int, error) {
+	dec := json.NewDecoder(r)
+	imported := 0
+	var pending *chunkedImport
+	defer func() {
+		if pending != nil {
+			pending.close()
+		}
+	}()
+	for {
+		var rec exportRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, fmt.Errorf("error reading export: %w", err)
+		}
+
+		if rec.Chunk != nil {
+			if pending == nil || pending.rec.Path != rec.Path {
+				return imported, fmt.Errorf("error importing %s: unexpected chunk %d", rec.Path, *rec.Chunk)
+			}
+			done, err := pending.add(*rec.Chunk, rec.Data)
+			if err != nil {
+				return imported, fmt.Errorf("error importing %s: %w", rec.Path, err)
+			}
+			if done {
+				if pending.w != nil {
+					imported++
+				}
+				pending.close()
+				pending = nil
+			}
+			continue
+		}
+
+		// A chunked entry whose chunks stopped early was rewritten during the export and is dropped
+		if pending != nil {
+			pending.close()
+			pending = nil
+		}
+		ok, chunked, err := importRecord(cacheDir, &rec)
+		if err != nil {
+			return imported, fmt.Errorf("error importing %s: %w", rec.Path, err)
+		}
+		if ok {
+			imported++
+		}
+		pending = chunked
+	}
+}
+
+// importRecord imports the entry described by rec. For a chunked entry, the chunkedImport
+// receiving the chunk records that follow is returned instead.
+func importRecord(cacheDir string, rec *exportRecord) (bool, *chunkedImport, error) {
+	rel := filepath.FromSlash(rec.Path)
+	if !filepath.IsLocal(rel) || !strings.HasSuffix(rel, ".json") || strings.HasPrefix(filepath.Base(rel), ".") {
+		return false, nil, errors.New("invalid path")
+	}
+	// Entries live in the cache directory or a namespace, possibly in the directory of a schema
+	// version, never in internal directories
+	namespace := filepath.Dir(rel)
+	if isSchemaDir(filepath.Base(namespace)) {
+		namespace = filepath.Dir(namespace)
+	}
+	if namespace != "." && validateNamespace(namespace) != nil {
+		return false, nil, errors.New("invalid path")
+	}
+	for suffix := range rec.Sidecars {
+		if suffix != ".key" && suffix != ".validator" && !(strings.HasPrefix(suffix, ".idx-") && !strings.ContainsAny(suffix, `/\`)) {
+			return false, nil, fmt.Errorf("invalid sidecar %q", suffix)
+		}
+	}
+	if rec.Manifest != nil && (!rec.Manifest.valid() || len(rec.Manifest.Chunks) == 0 || rec.Manifest.SHA256 != rec.SHA256) {
+		return false, nil, errors.New("invalid chunk manifest")
+	}
+	if rec.Manifest == nil && sha256Hex(rec.Data) != rec.SHA256 {
+		return false, nil, errors.New("checksum mismatch")
+	}
+
+	path := filepath.Join(cacheDir, rel)
+	skip := false
+	if info, err := statEntry(path, newOptions(nil)); err == nil && !info.ModTime().Before(rec.ModTime) {
+		skip = true
+	}
+	if !skip {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return false, nil, err
+		}
+	}
+
+	if rec.Manifest != nil {
+		c := &chunkedImport{rec: rec, path: path, sum: sha256.New()}
+		if !skip {
+			w, err := newChunkWriter(path, *rec.Manifest)
+			if err != nil {
+				return false, nil, err
+			}
+			c.w = w
+		}
+		return false, c, nil
+	}
+
+	if skip {
+		return false, nil, nil
+	}
+	if err := writeEntry("", path, rec.Data, newOptions(nil)); err != nil {
+		return false, nil, err
+	}
+	return true, nil, restoreEntryMetadata(path, rec)
+}
+
+// chunkedImport writes the chunks of a chunked entry as their records are read. w is nil
+// if a more recent local version of the entry is kept, the chunks are then only consumed.
+type chunkedImport struct {
+	rec  *exportRecord
+	path string
+	w    *chunkWriter
+	next int
+	sum  hash.Hash
+}
+
+// add writes the i-th chunk and reports whether it was the last one, in which case the entry
+// is committed.
+func (c *chunkedImport) add(i int, chunk []byte) (bool, error) {
+	if i != c.next {
+		return false, fmt.Errorf("unexpected chunk %d, expected %d", i, c.next)
+	}
+	c.next++
+	c.sum.Write(chunk)
+	if c.w != nil {
+		if err := c.w.writeChunk(i, chunk); err != nil {
+			return false, err
+		}
+	}
+	if c.next < len(c.rec.Manifest.Chunks) {
+		return false, nil
+	}
+
+	if c.w == nil {
+		return true, nil
+	}
+	if hex.EncodeToString(c.sum.Sum(nil)) != c.rec.SHA256 {
+		return false, errors.New("checksum mismatch")
+	}
+	if err := c.w.commit(); err != nil {
+		return false, err
+	}
+	// Drop what writeEntry drops when an entry becomes chunked, the sidecars of the export follow
+	for _, file := range []string{c.path, checksumPath(c.path), validatorPath(c.path)} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	if err := writeIndexes(c.path, c.rec.SHA256, nil); err != nil {
+		return false, err
+	}
+	return true, restoreEntryMetadata(c.path, c.rec)
+}
+
+// close releases the chunk writer, if any.
+func (c *chunkedImport) close() {
+	if c.w != nil {
+		_ = c.w.close()
+	}
+}
+
+// restoreEntryMetadata writes the sidecar files of rec next to the entry at path and gives the
+// entry the modification time it had in the export.
+func restoreEntryMetadata(path string, rec *exportRecord) error {
+	for suffix, sidecarData := range rec.Sidecars {
+		if err := writeFileAtomic(path+suffix, sidecarData); err != nil {
+			return err
+		}
+	}
+	err := os.Chtimes(path, rec.ModTime, rec.ModTime)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = os.Chtimes(manifestPath(path), rec.ModTime, rec.ModTime)
+	}
+	return err
+}
+
+// ExportHandler returns an http.Handler serving Export of `cacheDir` to GET requests, for
+// Bootstrap of new instances. The optional `limit` query parameter sets ExportConfig.Limit.
+// The export contains all cached data, so the handler must only be reachable by peers.
+func ExportHandler(cacheDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var cfg ExportConfig
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			cfg.Limit = n
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		// Errors after the first line can no longer change the status, the importing peer
+		// sees a truncated stream instead
+		_, _ = Export(w, cacheDir, cfg)
+	})
+}
+
+// Bootstrap fills `cacheDir` with the entries exported by the ExportHandler of a running peer at
+// `peerURL`, streaming them into Import. Call it before serving to start with a warm cache, or in
+// a goroutine to warm up while serving. It returns the number of imported entries.
+func Bootstrap(ctx context.Context, peerURL string, cacheDir string, cfg ExportConfig) (int, error) {
+	u, err := url.Parse(peerURL)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing peer URL: %w", err)
+	}
+	if cfg.Limit > 0 {
+		q := u.Query()
+		q.Set("limit", strconv.Itoa(cfg.Limit))
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching export from peer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error fetching export from peer: %s", resp.Status)
+	}
+
+	return Import(resp.Body, cacheDir)
+}
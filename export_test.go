@@ -0,0 +1,116 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	src := t.TempDir()
+	large := strings.Repeat("chunked ", 20)
+	if _, err := CompareAndSwap("large", src, "", large, WithChunkSize(16)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompareAndSwap("small", src, "", 1, WithNamespace("tenant"), WithSchemaVersion(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	var export bytes.Buffer
+	exported, err := Export(&export, src, ExportConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != 2 {
+		t.Fatalf("exported %d entries, want 2", exported)
+	}
+
+	dst := t.TempDir()
+	imported, err := Import(bytes.NewReader(export.Bytes()), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 2 {
+		t.Fatalf("imported %d entries, want 2", imported)
+	}
+	if got, _, err := ReadWithVersion[string]("large", dst); err != nil || got != large {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if got, _, err := ReadWithVersion[int]("small", dst, WithNamespace("tenant"), WithSchemaVersion(2)); err != nil || got != 1 {
+		t.Fatalf("got %d, %v", got, err)
+	}
+
+	// Entries are not older in the export than locally, importing again changes nothing
+	if imported, err := Import(bytes.NewReader(export.Bytes()), dst); err != nil || imported != 0 {
+		t.Fatalf("imported %d entries, %v, want 0", imported, err)
+	}
+}
+
+func TestImportRejectsInvalidRecords(t *testing.T) {
+	data := []byte(`1`)
+	valid := exportRecord{Path: "a.json", ModTime: time.Now(), SHA256: sha256Hex(data), Data: data}
+
+	tests := []struct {
+		name   string
+		modify func(rec *exportRecord)
+	}{
+		{"parent directory", func(rec *exportRecord) { rec.Path = "../a.json" }},
+		{"nested parent directory", func(rec *exportRecord) { rec.Path = "ns/../../a.json" }},
+		{"absolute path", func(rec *exportRecord) { rec.Path = "/tmp/a.json" }},
+		{"not an entry", func(rec *exportRecord) { rec.Path = "a.txt" }},
+		{"internal file", func(rec *exportRecord) { rec.Path = ".leases/a.json" }},
+		{"hidden file", func(rec *exportRecord) { rec.Path = "ns/.a.json" }},
+		{"internal file in schema version", func(rec *exportRecord) { rec.Path = ".leases/@v2/a.json" }},
+		{"nested schema versions", func(rec *exportRecord) { rec.Path = "@v1/@v2/a.json" }},
+		{"checksum mismatch", func(rec *exportRecord) { rec.SHA256 = sha256Hex([]byte(`2`)) }},
+		{"unknown sidecar", func(rec *exportRecord) { rec.Sidecars = map[string][]byte{".lock": nil} }},
+		{"sidecar path", func(rec *exportRecord) { rec.Sidecars = map[string][]byte{".idx-a/../../b": nil} }},
+		{"invalid manifest", func(rec *exportRecord) {
+			rec.Manifest = &chunkManifest{Size: 10, ChunkSize: 4, SHA256: rec.SHA256, Chunks: []string{"x"}}
+		}},
+	}
+	for _, tt := range tests {
+		rec := valid
+		tt.modify(&rec)
+		line, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := Import(bytes.NewReader(line), t.TempDir())
+		if err == nil || imported != 0 {
+			t.Errorf("%s: imported %d entries, %v", tt.name, imported, err)
+		}
+	}
+}
+
+func TestImportRejectsTamperedChunk(t *testing.T) {
+	src := t.TempDir()
+	if _, err := CompareAndSwap("large", src, "", strings.Repeat("x", 100), WithChunkSize(16)); err != nil {
+		t.Fatal(err)
+	}
+	var export bytes.Buffer
+	if _, err := Export(&export, src, ExportConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(export.String()), "\n")
+	var rec exportRecord
+	if err := json.Unmarshal([]byte(lines[2]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.Data = bytes.ToUpper(rec.Data)
+	tampered, _ := json.Marshal(rec)
+	lines[2] = string(tampered)
+
+	dst := t.TempDir()
+	if _, err := Import(strings.NewReader(strings.Join(lines, "\n")), dst); err == nil {
+		t.Fatal("tampered chunk imported")
+	}
+	if _, _, err := ReadWithVersion[string]("large", dst); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("incomplete entry visible: %v", err)
+	}
+}
@@ -1,10 +1,11 @@
 package get_with_cache_go
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
 )
 
 // GetDataFunc is a generic type for functions that return a value of type T and an error.
@@ -15,40 +16,132 @@ type GetDataFunc[T any] func() (T, error)
 // It checks for cached data in a file named `<cacheKey>.json` within `cacheDir`.
 // If the cache exists, it returns the cached data.
 // If not, it calls `getDataFunc` to fetch the data, caches it, and returns the data.
-func FetchDataWithCache[T any](getDataFunc GetDataFunc[T], cacheKey string, cacheDir string) (T, error) {
+// T can declare its own cache policy by implementing TTLPolicy, NamespacePolicy,
+// SchemaVersionPolicy or CacheablePolicy.
+func FetchDataWithCache[T any](getDataFunc GetDataFunc[T], cacheKey string, cacheDir string, opts ...Option) (T, error) {
+	return FetchDataWithCacheContext(context.Background(), getDataFunc, cacheKey, cacheDir, opts...)
+}
+
+// FetchDataWithCacheContext works like FetchDataWithCache but honours the cache Directives
+// attached to ctx, see WithDirectives and CacheControlMiddleware.
+func FetchDataWithCacheContext[T any](ctx context.Context, getDataFunc GetDataFunc[T], cacheKey string, cacheDir string, opts ...Option) (T, error) {
+	o := newOptionsFor[T](opts)
+	if o.err != nil {
+		var data T
+		return data, o.err
+	}
+	data, err := fetchWithCache(ctx, getDataFunc, cacheKey, cacheDir, o)
+	if err == nil {
+		o.prefetchAssociations(data)
+	}
+	return data, err
+}
+
+func fetchWithCache[T any](ctx context.Context, getDataFunc GetDataFunc[T], cacheKey string, cacheDir string, o *options) (T, error) {
 	var data T
-	cacheFilePath := filepath.Join(cacheDir, cacheKey+".json")
+	d := DirectivesFromContext(ctx)
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+	useCached := d.Mode != CacheModeNoCache && d.Mode != CacheModeNoStore
 
-	// Check if the cache file exists
-	if _, err := os.Stat(cacheFilePath); err == nil {
-		// Cache file exists, read and unmarshal it
-		fileData, err := os.ReadFile(cacheFilePath)
-		if err != nil {
-			return data, fmt.Errorf("error reading cache file: %w", err)
+	// Check if a usable cache entry exists
+	if useCached {
+		if data, ok, err := readCached[T](cacheFilePath, o, d); ok || err != nil {
+			if ok {
+				o.trackExpiry(cacheKey, cacheFilePath)
+				shadowFetch(getDataFunc, data, cacheKey, cacheFilePath, o)
+			}
+			return data, err
 		}
+	}
 
-		if err := json.Unmarshal(fileData, &data); err != nil {
-			return data, fmt.Errorf("error parsing cache file JSON: %w", err)
-		}
+	if d.Mode == CacheModeOnlyIfCached {
+		return data, ErrNotCached
+	}
 
+	if d.Mode == CacheModeNoStore {
+		data, err := getDataFunc()
+		if err != nil {
+			return data, fmt.Errorf("error fetching data: %w", err)
+		}
 		return data, nil
 	}
 
-	// Cache file does not exist, call getDataFunc to get the data
-	data, err := getDataFunc()
+	unlock, err := lockEntry(ctx, cacheFilePath, o)
+	if err != nil {
+		return data, fmt.Errorf("error locking cache entry: %w", err)
+	}
+	defer unlock()
+
+	// Another process may have stored the entry while we were waiting for the lock
+	if useCached {
+		if data, ok, err := readCached[T](cacheFilePath, o, d); ok || err != nil {
+			if ok {
+				o.trackExpiry(cacheKey, cacheFilePath)
+			}
+			return data, err
+		}
+	}
+
+	// Cache entry is not usable, call getDataFunc to get the data
+	data, err = getDataFunc()
 	if err != nil {
 		return data, fmt.Errorf("error fetching data: %w", err)
 	}
 
+	if !isCacheable(&data) {
+		return data, nil
+	}
+
 	// Marshal the data and save it to cache
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
 		return data, fmt.Errorf("error marshaling data to JSON: %w", err)
 	}
 
-	if err := os.WriteFile(cacheFilePath, dataBytes, 0644); err != nil {
+	if err := writeEntry(cacheKey, cacheFilePath, dataBytes, o); err != nil {
 		return data, fmt.Errorf("error writing cache file: %w", err)
 	}
+	o.trackExpiry(cacheKey, cacheFilePath)
+
+	return data, nil
+}
+
+// readCached returns the value of the entry at path if it exists and is fresh according
+// to the options and directives. ok is false if there is no such entry.
+func readCached[T any](path string, o *options, d Directives) (data T, ok bool, err error) {
+	info, err := statEntry(path, o)
+	if err != nil || !isFresh(info, o.ttl) || !isFresh(info, d.MaxAge) {
+		return data, false, nil
+	}
+
+	// Cache entry exists, read and unmarshal it
+	fileData, err := readEntry(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Removed since, or a chunked entry missing chunks, fetch it again
+		return data, false, nil
+	}
+	if err != nil {
+		return data, false, fmt.Errorf("error reading cache file: %w", err)
+	}
 
+	if err := json.Unmarshal(fileData, &data); err != nil {
+		return data, false, fmt.Errorf("error parsing cache file JSON: %w", err)
+	}
+
+	return data, true, nil
+}
+
+// ReadCacheRange returns up to `length` bytes of the encoded cache entry for `cacheKey`,
+// starting at byte `offset`. For chunked entries only the chunks covering the range are read.
+// Fewer bytes are returned when the range extends past the end of the entry.
+func ReadCacheRange(cacheKey string, cacheDir string, offset int64, length int64, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	data, err := readEntryRange(entryPath(cacheDir, cacheKey, o), offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache file: %w", err)
+	}
 	return data, nil
 }
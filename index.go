@@ -0,0 +1,206 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectionIndex maps the JSON encoding of a field value to the byte ranges
+// (offset and length) of the collection items having that value.
+type collectionIndex map[string][][2]int64
+
+// indexFile is the stored form of an index. SHA256 is the hex encoded SHA-256 of the payload
+// the index was built from, as the index and the payload are not replaced atomically together.
+type indexFile struct {
+	SHA256 string          `json:"sha256"`
+	Items  collectionIndex `json:"items"`
+}
+
+// WithIndex declares a secondary index `name` on the top-level JSON field `field` of the items
+// of cached collections (values encoding to a JSON array). The index is rebuilt whenever the
+// entry is written and is queried with LookupIndex. Writing an entry without an index option
+// drops that index. The name becomes part of a file name, so it must not be empty, start with a
+// dot or contain path separators or the glob metacharacters `*?[\`.
+func WithIndex(name string, field string) Option {
+	return func(o *options) {
+		if err := validateIndexName(name); err != nil {
+			o.err = err
+			return
+		}
+		if o.indexes == nil {
+			o.indexes = map[string]string{}
+		}
+		o.indexes[name] = field
+	}
+}
+
+// LookupIndex returns the items of the cached collection for `cacheKey` whose field indexed as
+// `index` (see WithIndex) encodes to the same JSON as `value`. Only the matching items are read
+// and decoded into T. ErrNotCached is returned if there is no fresh entry, and an error if the
+// entry was replaced since the index was read.
+func LookupIndex[T any](cacheKey string, cacheDir string, index string, value any, opts ...Option) ([]T, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	if err := validateIndexName(index); err != nil {
+		return nil, err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	info, err := statEntry(cacheFilePath, o)
+	if err != nil || !isFresh(info, o.ttl) {
+		return nil, ErrNotCached
+	}
+
+	indexData, err := os.ReadFile(indexPath(cacheFilePath, index))
+	if err != nil {
+		return nil, fmt.Errorf("error reading index %q: %w", index, err)
+	}
+	var idx indexFile
+	if err := json.Unmarshal(indexData, &idx); err != nil {
+		return nil, fmt.Errorf("error parsing index %q: %w", index, err)
+	}
+	readRange, err := indexedPayload(cacheFilePath, idx.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error reading index %q: %w", index, err)
+	}
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling lookup value to JSON: %w", err)
+	}
+
+	var items []T
+	for _, r := range idx.Items[string(valueBytes)] {
+		itemData, err := readRange(r[0], r[1])
+		if err != nil {
+			return nil, fmt.Errorf("error reading cache file: %w", err)
+		}
+		var item T
+		if err := json.Unmarshal(itemData, &item); err != nil {
+			return nil, fmt.Errorf("error parsing indexed item JSON: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// validateIndexName checks that name can be used in the file name of an index and matches
+// only itself in the patterns globbing the indexes of an entry.
+func validateIndexName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\*?[`) {
+		return fmt.Errorf("invalid index name %q", name)
+	}
+	return nil
+}
+
+func indexPath(path string, name string) string {
+	return path + ".idx-" + name
+}
+
+// indexedPayload returns a function reading ranges of the payload of the entry at path, after checking
+// that the payload is the one with checksum sum an index was built from. Single-file payloads are
+// read and hashed once, chunked payloads are read with the manifest carrying that checksum.
+func indexedPayload(path string, sum string) (func(offset int64, length int64) ([]byte, error), error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if sha256Hex(data) != sum {
+			return nil, errors.New("index is out of date")
+		}
+		return func(offset int64, length int64) ([]byte, error) {
+			return data[offset : offset+clampRange(int64(len(data)), offset, length)], nil
+		}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	m, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	if m.SHA256 != sum {
+		return nil, errors.New("index is out of date")
+	}
+	return func(offset int64, length int64) ([]byte, error) {
+		return readChunks(path, m, offset, clampRange(m.Size, offset, length))
+	}, nil
+}
+
+// writeIndexes stores the indexes built for the payload with checksum sum at path and removes
+// the indexes of the entry that are not among them.
+func writeIndexes(path string, sum string, built map[string]collectionIndex) error {
+	existing, err := filepath.Glob(indexPath(path, "*"))
+	if err != nil {
+		return err
+	}
+	for _, p := range existing {
+		if _, ok := built[strings.TrimPrefix(p, indexPath(path, ""))]; !ok {
+			if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	for name, idx := range built {
+		indexData, err := json.Marshal(indexFile{SHA256: sum, Items: idx})
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(indexPath(path, name), indexData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIndexes scans the items of the JSON array data, recording their byte ranges by field value.
+// Without declared indexes nothing is built and data may be any JSON value.
+func buildIndexes(data []byte, indexes map[string]string) (map[string]collectionIndex, error) {
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, errors.New("indexed entries must encode to a JSON array")
+	}
+
+	built := map[string]collectionIndex{}
+	for name := range indexes {
+		built[name] = collectionIndex{}
+	}
+	for dec.More() {
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		end := dec.InputOffset()
+		itemRange := [2]int64{end - int64(len(item)), int64(len(item))}
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(item, &fields) != nil {
+			// Only objects can be indexed
+			continue
+		}
+		for name, field := range indexes {
+			fieldValue, ok := fields[field]
+			if !ok {
+				continue
+			}
+			var key bytes.Buffer
+			if err := json.Compact(&key, fieldValue); err != nil {
+				return nil, err
+			}
+			built[name][key.String()] = append(built[name][key.String()], itemRange)
+		}
+	}
+	return built, nil
+}
@@ -0,0 +1,117 @@
+package get_with_cache_go
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type indexedItem struct {
+	ID    int    `json:"id"`
+	Owner string `json:"owner"`
+}
+
+func TestLookupIndex(t *testing.T) {
+	items := []indexedItem{{1, "ann"}, {2, "bob"}, {3, "ann"}, {4, "cid"}}
+	for _, chunkSize := range []int64{0, 10} {
+		dir := t.TempDir()
+		opts := []Option{WithIndex("owner", "owner"), WithIndex("id", "id"), WithChunkSize(chunkSize)}
+		if _, err := CompareAndSwap("items", dir, "", items, opts...); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			index string
+			value any
+			want  []indexedItem
+		}{
+			{"owner", "ann", []indexedItem{{1, "ann"}, {3, "ann"}}},
+			{"owner", "cid", []indexedItem{{4, "cid"}}},
+			{"owner", "dan", nil},
+			{"id", 2, []indexedItem{{2, "bob"}}},
+		}
+		for _, tt := range tests {
+			got, err := LookupIndex[indexedItem]("items", dir, tt.index, tt.value, opts...)
+			if err != nil {
+				t.Fatalf("chunk size %d: %v", chunkSize, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunk size %d, %s=%v: got %+v, want %+v", chunkSize, tt.index, tt.value, got, tt.want)
+			}
+		}
+
+		if _, err := LookupIndex[indexedItem]("items", dir, "missing", "x", opts...); err == nil {
+			t.Errorf("chunk size %d: lookup in an undeclared index succeeded", chunkSize)
+		}
+	}
+}
+
+func TestLookupIndexMissingEntry(t *testing.T) {
+	if _, err := LookupIndex[indexedItem]("items", t.TempDir(), "owner", "ann"); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("got %v, want %v", err, ErrNotCached)
+	}
+}
+
+func TestWriteIndexedEntryRejectsNonArray(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CompareAndSwap("items", dir, "", map[string]int{"a": 1}, WithIndex("owner", "owner")); err == nil {
+		t.Fatal("indexed write of an object succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "items.json")); !os.IsNotExist(err) {
+		t.Fatalf("entry written despite the index error: %v", err)
+	}
+}
+
+func TestLookupIndexDetectsReplacedPayload(t *testing.T) {
+	dir := t.TempDir()
+	items := []indexedItem{{1, "ann"}, {2, "bob"}}
+	if _, err := CompareAndSwap("items", dir, "", items, WithIndex("owner", "owner")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the payload behind the index's back, shifting the items
+	if err := os.WriteFile(filepath.Join(dir, "items.json"), []byte(`[{"id":10,"owner":"zed"},{"id":1,"owner":"ann"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LookupIndex[indexedItem]("items", dir, "owner", "ann")
+	if err == nil || !strings.Contains(err.Error(), "out of date") {
+		t.Fatalf("got %v, want an out of date index", err)
+	}
+}
+
+func TestWriteEntryDropsUndeclaredIndexes(t *testing.T) {
+	dir := t.TempDir()
+	items := []indexedItem{{1, "ann"}}
+	if _, err := CompareAndSwap("items", dir, "", items, WithIndex("owner", "owner")); err != nil {
+		t.Fatal(err)
+	}
+	_, version, err := ReadWithVersion[[]indexedItem]("items", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompareAndSwap("items", dir, version, items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(indexPath(filepath.Join(dir, "items.json"), "owner")); !os.IsNotExist(err) {
+		t.Fatalf("undeclared index kept: %v", err)
+	}
+}
+
+func TestWithIndexRejectsInvalidNames(t *testing.T) {
+	items := []indexedItem{{1, "ann"}}
+	for _, name := range []string{"", ".hidden", "a/b", `a\b`, "*", "a?", "[a]", "../owner"} {
+		dir := t.TempDir()
+		if _, err := CompareAndSwap("items", dir, "", items, WithIndex(name, "owner")); err == nil {
+			t.Errorf("index name %q accepted", name)
+		}
+		if files, _ := os.ReadDir(dir); len(files) != 0 {
+			t.Errorf("index name %q: entry written", name)
+		}
+		if _, err := LookupIndex[indexedItem]("items", dir, name, "ann"); err == nil || errors.Is(err, ErrNotCached) {
+			t.Errorf("index name %q: lookup returned %v", name, err)
+		}
+	}
+}
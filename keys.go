@@ -0,0 +1,72 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListKeys returns the cache keys of the entries stored in `cacheDir`, within the namespace and
+// schema version given by WithNamespace and WithSchemaVersion. With WithPrivateKeys the keys are
+// decrypted from the entries' key files, entries written with a different secret or without
+// private keys are skipped. Without it, file names are returned without their suffix.
+func ListKeys(cacheDir string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	dir := entryDir(cacheDir, o)
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing cache directory: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, e := range dirEntries {
+		name := strings.TrimSuffix(e.Name(), ".manifest")
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		cacheKey := strings.TrimSuffix(name, ".json")
+		if o.privateKeys != nil {
+			path := filepath.Join(dir, name)
+			if cacheKey, err = o.privateKeys.readKeyFile(path); err != nil || entryPath(cacheDir, cacheKey, o) != path {
+				continue
+			}
+		}
+		seen[cacheKey] = true
+	}
+
+	keys := make([]string, 0, len(seen))
+	for cacheKey := range seen {
+		keys = append(keys, cacheKey)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Invalidate removes the cache entry for `cacheKey`, including its chunks, indexes and key file,
+// so that the next fetch calls getDataFunc again.
+func Invalidate(cacheKey string, cacheDir string, opts ...Option) error {
+	o := newOptions(opts)
+	if o.err != nil {
+		return o.err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	unlock, err := lockEntry(context.Background(), cacheFilePath, o)
+	if err != nil {
+		return fmt.Errorf("error locking cache entry: %w", err)
+	}
+	defer unlock()
+
+	if err := removeEntry(cacheFilePath); err != nil {
+		return fmt.Errorf("error removing cache entry: %w", err)
+	}
+	o.untrackExpiry(cacheKey)
+	return nil
+}
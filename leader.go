@@ -0,0 +1,158 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	leasesDir = ".leases"
+	// minLeaseTTL keeps lease renewals well above the resolution of file modification times
+	minLeaseTTL = 100 * time.Millisecond
+)
+
+// LeaderElector elects a single leader among replicas sharing a cache directory, using a lease
+// file in the `.leases` directory. The leader renews the lease every third of the lease TTL.
+// A lease not renewed for a whole TTL, e.g. because its holder crashed, is taken over by another
+// replica.
+type LeaderElector struct {
+	path     string
+	id       string
+	leaseTTL time.Duration
+	locker   Locker
+}
+
+type lease struct {
+	Holder string `json:"holder"`
+}
+
+// NewLeaderElector returns a LeaderElector for the lease `name` in `cacheDir`. `id` identifies this
+// replica and must be unique among the replicas, e.g. the host name and process ID. An error is
+// returned if name is not a plain file name or leaseTTL is shorter than 100ms.
+func NewLeaderElector(cacheDir string, name string, id string, leaseTTL time.Duration) (*LeaderElector, error) {
+	if name == "" || name != filepath.Base(name) || !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("invalid lease name %q", name)
+	}
+	if leaseTTL < minLeaseTTL {
+		return nil, fmt.Errorf("lease TTL %s is shorter than %s", leaseTTL, minLeaseTTL)
+	}
+	return &LeaderElector{
+		path:     filepath.Join(cacheDir, leasesDir, name+".lease"),
+		id:       id,
+		leaseTTL: leaseTTL,
+		locker:   LockFileLocker{},
+	}, nil
+}
+
+// Run campaigns for leadership until ctx is done and calls `work` whenever this replica becomes
+// the leader, e.g. to run StartScrubber or scheduled refreshes on a single replica. The context
+// passed to work is cancelled when leadership is lost, and Run waits for work to return before
+// campaigning again. Run returns nil when work returns on its own while leading, and the
+// context's error when ctx is done.
+func (e *LeaderElector) Run(ctx context.Context, work func(ctx context.Context)) error {
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		return fmt.Errorf("error creating lease directory: %w", err)
+	}
+
+	for {
+		if e.acquire(ctx) {
+			if done, err := e.lead(ctx, work); done {
+				return err
+			}
+		}
+		if err := sleepContext(ctx, e.leaseTTL/3); err != nil {
+			return err
+		}
+	}
+}
+
+// lead runs work while renewing the lease. done is false if leadership was lost.
+func (e *LeaderElector) lead(ctx context.Context, work func(ctx context.Context)) (done bool, err error) {
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workDone := make(chan struct{})
+	go func() {
+		defer close(workDone)
+		work(workCtx)
+	}()
+
+	ticker := time.NewTicker(e.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			<-workDone
+			e.release()
+			return true, ctx.Err()
+		case <-workDone:
+			e.release()
+			// Work that returned because ctx is done did not return on its own
+			return true, ctx.Err()
+		case <-ticker.C:
+			if !e.acquire(ctx) {
+				cancel()
+				<-workDone
+				return false, nil
+			}
+		}
+	}
+}
+
+// acquire takes or renews the lease and reports whether this replica holds it.
+// Errors count as not holding the lease.
+func (e *LeaderElector) acquire(ctx context.Context) bool {
+	unlock, err := e.locker.Lock(ctx, lockPath(e.path))
+	if err != nil {
+		return false
+	}
+	defer unlock()
+
+	current, info, err := e.read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err == nil && current.Holder != e.id && entryAge(info) <= e.leaseTTL {
+		return false
+	}
+
+	leaseData, err := json.Marshal(lease{Holder: e.id})
+	if err != nil {
+		return false
+	}
+	return writeFileAtomic(e.path, leaseData) == nil
+}
+
+// release gives up the lease if this replica still holds it.
+func (e *LeaderElector) release() {
+	unlock, err := e.locker.Lock(context.Background(), lockPath(e.path))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	if current, _, err := e.read(); err == nil && current.Holder == e.id {
+		_ = os.Remove(e.path)
+	}
+}
+
+func (e *LeaderElector) read() (*lease, os.FileInfo, error) {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaseData, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var l lease
+	if err := json.Unmarshal(leaseData, &l); err != nil {
+		return nil, nil, err
+	}
+	return &l, info, nil
+}
@@ -0,0 +1,167 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testLeaseTTL = minLeaseTTL
+
+func newTestElector(t *testing.T, dir string, id string) *LeaderElector {
+	t.Helper()
+	e, err := NewLeaderElector(dir, "test", id, testLeaseTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// runElector runs e in the background. The returned channel receives the context of every
+// call of work, which blocks until that context is done.
+func runElector(ctx context.Context, e *LeaderElector) (<-chan context.Context, <-chan error) {
+	leading := make(chan context.Context, 10)
+	result := make(chan error, 1)
+	go func() {
+		result <- e.Run(ctx, func(ctx context.Context) {
+			leading <- ctx
+			<-ctx.Done()
+		})
+	}()
+	return leading, result
+}
+
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(20 * testLeaseTTL):
+		t.Fatalf("timed out waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+func TestNewLeaderElectorValidation(t *testing.T) {
+	for _, name := range []string{"", "..", "a/b", "../a"} {
+		if _, err := NewLeaderElector(t.TempDir(), name, "a", time.Second); err == nil {
+			t.Errorf("lease name %q accepted", name)
+		}
+	}
+	if _, err := NewLeaderElector(t.TempDir(), "a", "a", minLeaseTTL/2); err == nil {
+		t.Error("lease TTL below minimum accepted")
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	dir := t.TempDir()
+	a, b := newTestElector(t, dir, "a"), newTestElector(t, dir, "b")
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	leadingA, resultA := runElector(ctxA, a)
+	waitFor(t, leadingA, "a to lead")
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	leadingB, resultB := runElector(ctxB, b)
+
+	// a renews its lease, so b does not take over while a is running
+	time.Sleep(3 * testLeaseTTL)
+	select {
+	case <-leadingB:
+		t.Fatal("b leads while a holds the lease")
+	default:
+	}
+	if info, err := os.Stat(a.path); err != nil || entryAge(info) > testLeaseTTL {
+		t.Fatalf("lease not renewed: %v", err)
+	}
+
+	// a releases the lease when it stops, so b takes over without waiting for it to expire
+	cancelA()
+	if err := waitFor(t, resultA, "a to stop"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("a returned %v", err)
+	}
+	waitFor(t, leadingB, "b to lead")
+
+	cancelB()
+	if err := waitFor(t, resultB, "b to stop"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("b returned %v", err)
+	}
+	if _, err := os.Stat(b.path); !os.IsNotExist(err) {
+		t.Fatalf("lease not released: %v", err)
+	}
+}
+
+func TestLeaderTakeoverAfterExpiry(t *testing.T) {
+	dir := t.TempDir()
+	crashed, e := newTestElector(t, dir, "crashed"), newTestElector(t, dir, "e")
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !crashed.acquire(context.Background()) {
+		t.Fatal("crashed did not acquire the free lease")
+	}
+
+	if e.acquire(context.Background()) {
+		t.Fatal("e acquired a lease held by another replica")
+	}
+	expired := time.Now().Add(-2 * testLeaseTTL)
+	if err := os.Chtimes(e.path, expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	if !e.acquire(context.Background()) {
+		t.Fatal("e did not take over the expired lease")
+	}
+	if l, _, err := e.read(); err != nil || l.Holder != "e" {
+		t.Fatalf("got lease %+v, %v", l, err)
+	}
+}
+
+func TestLeaderLosesLeadership(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestElector(t, dir, "e")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leading, result := runElector(ctx, e)
+	workCtx := waitFor(t, leading, "e to lead")
+
+	// Another replica took the lease, e.g. after e failed to renew it in time
+	if err := writeFileAtomic(e.path, []byte(`{"holder":"other"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// and keeps renewing it
+	renewed := time.Now().Add(time.Hour)
+	if err := os.Chtimes(e.path, renewed, renewed); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, workCtx.Done(), "work to be cancelled")
+	if ctx.Err() != nil {
+		t.Fatal("Run's context cancelled")
+	}
+
+	// e keeps campaigning and leaves the other replica's lease alone
+	select {
+	case err := <-result:
+		t.Fatalf("Run returned %v after losing leadership", err)
+	default:
+	}
+	if l, _, err := e.read(); err != nil || l.Holder != "other" {
+		t.Fatalf("got lease %+v, %v", l, err)
+	}
+	cancel()
+	waitFor(t, result, "e to stop")
+}
+
+func TestLeaderWorkReturns(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestElector(t, dir, "e")
+	if err := e.Run(context.Background(), func(context.Context) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(e.path); !os.IsNotExist(err) {
+		t.Fatalf("lease not released: %v", err)
+	}
+}
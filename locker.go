@@ -0,0 +1,267 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLockRetryInterval = 50 * time.Millisecond
+	defaultLockHeartbeat     = 5 * time.Second
+)
+
+// Locker serializes the fetching and writing of a cache entry across goroutines and processes.
+// It is selected per call with WithLocker.
+type Locker interface {
+	// Lock blocks until the lock named by path is held or ctx is done.
+	// The returned function releases the lock.
+	Lock(ctx context.Context, path string) (unlock func() error, err error)
+}
+
+// NoopLocker does not lock at all. It is the default, concurrent misses for the same key
+// then each call their getDataFunc and the last write wins.
+type NoopLocker struct{}
+
+func (NoopLocker) Lock(context.Context, string) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+// LockFileLocker locks by atomically creating a lock file (O_EXCL) or, with UseMkdir, a lock
+// directory. Both are atomic on NFS, unlike flock. The holder refreshes the modification time
+// of the lock every Heartbeat, and a lock not refreshed for StaleAfter is considered abandoned
+// by a crashed process and broken. The zero value uses a 5s heartbeat and a StaleAfter of
+// four heartbeats.
+type LockFileLocker struct {
+	Heartbeat     time.Duration
+	StaleAfter    time.Duration
+	RetryInterval time.Duration
+	UseMkdir      bool
+}
+
+func (l LockFileLocker) Lock(ctx context.Context, path string) (func() error, error) {
+	heartbeat := l.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultLockHeartbeat
+	}
+	staleAfter := l.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 4 * heartbeat
+	}
+
+	var created os.FileInfo
+	for {
+		err := l.create(path)
+		if err == nil {
+			if created, err = os.Stat(path); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		// Break the lock if its holder stopped refreshing it
+		if broken, err := breakStaleLock(path, staleAfter); err != nil {
+			return nil, err
+		} else if broken {
+			continue
+		}
+
+		if err := sleepContext(ctx, l.RetryInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				_ = os.Chtimes(path, now, now)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			close(stop)
+			<-done
+			// Leave the lock alone if it was broken and taken by another locker meanwhile
+			if current, statErr := os.Stat(path); statErr == nil && os.SameFile(created, current) {
+				err = os.RemoveAll(path)
+			}
+		})
+		return err
+	}, nil
+}
+
+// breakStaleLock removes the lock at path if it was not refreshed for staleAfter and reports
+// whether it did. Breaking is serialized by a second lock file next to the lock and the lock
+// is checked again once that is held, so that a locker which saw the stale lock never removes
+// the lock another locker took after breaking it first.
+func breakStaleLock(path string, staleAfter time.Duration) (bool, error) {
+	if info, err := os.Stat(path); err != nil || time.Since(info.ModTime()) <= staleAfter {
+		return false, nil
+	}
+
+	breaker := path + ".break"
+	f, err := os.OpenFile(breaker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		// The breaker lock is only held for a moment, one this old was left by a crashed process
+		if info, err := os.Stat(breaker); err == nil && time.Since(info.ModTime()) > staleAfter {
+			removeIfSame(breaker, info)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	defer os.Remove(breaker)
+
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) <= staleAfter {
+		return false, nil
+	}
+	return true, os.RemoveAll(path)
+}
+
+// removeIfSame removes the file at path if it is still the file described by info: the file is
+// moved aside first and moved back if it turns out to have been replaced.
+func removeIfSame(path string, info os.FileInfo) {
+	moved := fmt.Sprintf("%s.stale-%d", path, time.Now().UnixNano())
+	if os.Rename(path, moved) != nil {
+		return
+	}
+	if current, err := os.Stat(moved); err == nil && !os.SameFile(info, current) {
+		_ = os.Link(moved, path)
+	}
+	_ = os.Remove(moved)
+}
+
+func (l LockFileLocker) create(path string) error {
+	if l.UseMkdir {
+		return os.Mkdir(path, 0755)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+	return f.Close()
+}
+
+// WithLocker sets the Locker used to serialize fetching and writing of an entry.
+// Defaults to NoopLocker, except for CompareAndSwap and PatchCache which then lock with a LockFileLocker.
+func WithLocker(l Locker) Option {
+	return func(o *options) {
+		o.locker = l
+	}
+}
+
+// lockEntry takes the configured lock for the entry at path, creating the entry's directory if needed.
+func lockEntry(ctx context.Context, path string, o *options) (func() error, error) {
+	if o.inSubdirectory() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return o.locker.Lock(ctx, lockPath(path))
+}
+
+// lockEntryExclusive is lockEntry for read-modify-write operations, which must not lose updates
+// even when no Locker is configured: with the default NoopLocker a LockFileLocker is used instead.
+func lockEntryExclusive(ctx context.Context, path string, o *options) (func() error, error) {
+	if _, ok := o.locker.(NoopLocker); !ok {
+		return lockEntry(ctx, path, o)
+	}
+	exclusive := *o
+	exclusive.locker = LockFileLocker{}
+	return lockEntry(ctx, path, &exclusive)
+}
+
+// lockPath returns the path of the lock for the entry at path.
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// sleepContext waits for interval (or the default lock retry interval if interval is not positive)
+// or until ctx is done.
+func sleepContext(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultLockRetryInterval
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// processLocks serializes goroutines of this process per lock path, for lock mechanisms
+// that are owned by the process rather than by a goroutine.
+var processLocks = &pathMutex{locks: map[string]*pathLock{}}
+
+type pathMutex struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is the lock of a single path. It is dropped from its pathMutex once no goroutine
+// holds or waits for it, so that the locks of paths used once do not accumulate.
+type pathLock struct {
+	ch    chan struct{}
+	users int
+}
+
+func (m *pathMutex) lock(ctx context.Context, path string) (func(), error) {
+	m.mu.Lock()
+	l, ok := m.locks[path]
+	if !ok {
+		l = &pathLock{ch: make(chan struct{}, 1)}
+		m.locks[path] = l
+	}
+	l.users++
+	m.mu.Unlock()
+
+	select {
+	case l.ch <- struct{}{}:
+		return func() {
+			<-l.ch
+			m.release(path, l)
+		}, nil
+	case <-ctx.Done():
+		m.release(path, l)
+		return nil, ctx.Err()
+	}
+}
+
+// release drops a user of the lock l of path, and the lock once it has no users left.
+func (m *pathMutex) release(path string, l *pathLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.users--
+	if l.users == 0 {
+		delete(m.locks, path)
+	}
+}
@@ -0,0 +1,213 @@
+package get_with_cache_go
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLockers are the lockers exercised across processes, by name.
+var testLockers = map[string]Locker{
+	"file":  LockFileLocker{Heartbeat: 100 * time.Millisecond, RetryInterval: time.Millisecond},
+	"mkdir": LockFileLocker{Heartbeat: 100 * time.Millisecond, RetryInterval: time.Millisecond, UseMkdir: true},
+}
+
+const lockerHelperEnv = "GET_WITH_CACHE_LOCKER_HELPER"
+
+// TestLockerHelperProcess is not a test: it is run by TestLockerMutualExclusion in child processes,
+// which lock repeatedly and log entering and leaving the critical section.
+func TestLockerHelperProcess(t *testing.T) {
+	spec := os.Getenv(lockerHelperEnv)
+	if spec == "" {
+		t.Skip("helper process")
+	}
+	name, spec, _ := strings.Cut(spec, ":")
+	runs, dir, _ := strings.Cut(spec, ":")
+	locker := testLockers[name]
+	n, err := strconv.Atoi(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, "log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	pid := os.Getpid()
+	for range n {
+		unlock, err := locker.Lock(context.Background(), filepath.Join(dir, "entry.json.lock"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(log, "start %d\n", pid)
+		time.Sleep(time.Millisecond)
+		fmt.Fprintf(log, "end %d\n", pid)
+		if err := unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLockerMutualExclusion(t *testing.T) {
+	// Starting the child processes dominates, short runs only start a few
+	processes, runs := 4, 20
+	if testing.Short() {
+		processes, runs = 2, 5
+	}
+	for name := range testLockers {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var wg sync.WaitGroup
+			errs := make([]error, processes)
+			for i := range processes {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					cmd := exec.Command(os.Args[0], "-test.run=^TestLockerHelperProcess$")
+					cmd.Env = append(os.Environ(), lockerHelperEnv+"="+name+":"+strconv.Itoa(runs)+":"+dir)
+					if out, err := cmd.CombinedOutput(); err != nil {
+						errs[i] = fmt.Errorf("%w: %s", err, out)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if err := errors.Join(errs...); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(filepath.Join(dir, "log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			lines := 0
+			holder := ""
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				lines++
+				event, pid, _ := strings.Cut(scanner.Text(), " ")
+				switch {
+				case event == "start" && holder == "":
+					holder = pid
+				case event == "end" && holder == pid:
+					holder = ""
+				default:
+					t.Fatalf("line %d: %q while the lock is held by %q", lines, scanner.Text(), holder)
+				}
+			}
+			if want := 2 * processes * runs; lines != want {
+				t.Fatalf("got %d log lines, want %d", lines, want)
+			}
+		})
+	}
+}
+
+func TestLockFileLockerBreaksStaleLock(t *testing.T) {
+	for _, useMkdir := range []bool{false, true} {
+		t.Run("mkdir="+strconv.FormatBool(useMkdir), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "entry.json.lock")
+			l := LockFileLocker{Heartbeat: 50 * time.Millisecond, StaleAfter: time.Second, RetryInterval: time.Millisecond, UseMkdir: useMkdir}
+			if err := l.create(path); err != nil {
+				t.Fatal(err)
+			}
+			old := time.Now().Add(-time.Minute)
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+
+			// Many lockers see the stale lock at once, only one of them may hold the lock at a time
+			var holders, maxHolders atomic.Int32
+			var wg sync.WaitGroup
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					unlock, err := l.Lock(ctx, path)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					n := holders.Add(1)
+					for m := maxHolders.Load(); n > m && !maxHolders.CompareAndSwap(m, n); m = maxHolders.Load() {
+					}
+					time.Sleep(20 * time.Millisecond)
+					holders.Add(-1)
+					if err := unlock(); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := maxHolders.Load(); got != 1 {
+				t.Fatalf("lock held by %d lockers at once", got)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("lock not removed after unlocking: %v", err)
+			}
+		})
+	}
+}
+
+func TestLockFileLockerKeepsFreshLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.json.lock")
+	l := LockFileLocker{Heartbeat: 50 * time.Millisecond, RetryInterval: time.Millisecond}
+	unlock, err := l.Lock(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	// The heartbeat keeps the lock fresh for longer than StaleAfter
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := l.Lock(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPathMutexDropsUnusedLocks(t *testing.T) {
+	m := &pathMutex{locks: map[string]*pathLock{}}
+	unlock, err := m.lock(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting for a held lock until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.lock(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	waiting := make(chan func())
+	go func() {
+		unlock, err := m.lock(context.Background(), "a")
+		if err != nil {
+			t.Error(err)
+		}
+		waiting <- unlock
+	}()
+	unlock()
+	(<-waiting)()
+
+	if len(m.locks) != 0 {
+		t.Fatalf("%d locks left", len(m.locks))
+	}
+}
@@ -0,0 +1,63 @@
+//go:build unix
+
+package get_with_cache_go
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FcntlLocker locks with POSIX record locks (fcntl F_SETLK) on a lock file, which NFS
+// forwards to the server's lock manager. As these locks are owned by the process,
+// goroutines of the same process are additionally serialized in memory.
+type FcntlLocker struct {
+	RetryInterval time.Duration
+}
+
+func (l FcntlLocker) Lock(ctx context.Context, path string) (func() error, error) {
+	release, err := processLocks.lock(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart}
+	for {
+		err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EAGAIN) && !errors.Is(err, syscall.EACCES) {
+			f.Close()
+			release()
+			return nil, err
+		}
+		if err := sleepContext(ctx, l.RetryInterval); err != nil {
+			f.Close()
+			release()
+			return nil, err
+		}
+	}
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			defer release()
+			// The lock file is kept, removing it would let another process lock a different inode
+			lk.Type = syscall.F_UNLCK
+			err = errors.Join(syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk), f.Close())
+		})
+		return err
+	}, nil
+}
@@ -0,0 +1,9 @@
+//go:build unix
+
+package get_with_cache_go
+
+import "time"
+
+func init() {
+	testLockers["fcntl"] = FcntlLocker{RetryInterval: time.Millisecond}
+}
@@ -0,0 +1,111 @@
+package get_with_cache_go
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Option configures optional behaviour of the cache functions.
+type Option func(*options)
+
+type options struct {
+	chunkSize int64
+	ttl       time.Duration
+	locker    Locker
+	indexes   map[string]string
+
+	privateKeys   *privateKeys
+	namespace     string
+	schemaVersion int
+
+	skewAllowance time.Duration
+
+	associations     func(value any) []Association
+	prefetchPerFetch int
+	prefetchSlots    chan struct{}
+
+	shadow      *ShadowConfig
+	shadowSlots chan struct{}
+
+	expiryScheduler *ExpiryScheduler
+
+	// err records an invalid option, it is returned by the function the options are passed to
+	err error
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		locker:           NoopLocker{},
+		prefetchPerFetch: defaultPrefetchPerFetch,
+		prefetchSlots:    defaultPrefetchSlots,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// newOptionsFor applies opts on top of the cache policy declared by the value type T,
+// see TTLPolicy, NamespacePolicy and SchemaVersionPolicy.
+func newOptionsFor[T any](opts []Option) *options {
+	return newOptions(append(typePolicy[T](), opts...))
+}
+
+// WithChunkSize enables chunked storage. Entries whose encoded size exceeds `size` bytes
+// are split into chunks of `size` bytes, described by a manifest next to the cache file.
+// A size of 0 (the default) disables chunking.
+func WithChunkSize(size int64) Option {
+	return func(o *options) {
+		o.chunkSize = size
+	}
+}
+
+// WithTTL limits the lifetime of cache entries. Entries written more than `ttl` ago count as
+// missing and are fetched again. A ttl of 0 (the default) keeps entries forever.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithNamespace stores entries in the subdirectory `namespace` of the cache directory.
+// The namespace must be a local path below the cache directory, none of whose elements
+// starts with a dot, which are reserved for internal files, or with "@", which are reserved
+// for schema versions.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		if namespace != "" {
+			if err := validateNamespace(namespace); err != nil {
+				o.err = err
+				return
+			}
+		}
+		o.namespace = namespace
+	}
+}
+
+// WithSchemaVersion stores entries in a subdirectory for `version` of the namespace, so that entries
+// written for other versions of the value type are ignored. Version 0 (the default) stores entries
+// in the namespace directory itself.
+func WithSchemaVersion(version int) Option {
+	return func(o *options) {
+		o.schemaVersion = version
+	}
+}
+
+// validateNamespace checks that namespace names a subdirectory of the cache directory that is
+// neither internal, such as `.leases` or `.quarantine`, nor the directory of a schema version.
+func validateNamespace(namespace string) error {
+	clean := filepath.Clean(namespace)
+	if !filepath.IsLocal(namespace) || clean == "." {
+		return fmt.Errorf("invalid namespace %q", namespace)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(clean), "/") {
+		if strings.HasPrefix(element, ".") || strings.HasPrefix(element, "@") {
+			return fmt.Errorf("invalid namespace %q", namespace)
+		}
+	}
+	return nil
+}
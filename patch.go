@@ -0,0 +1,106 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// PatchCache applies the JSON merge patch `patch` (RFC 7396) to the cached entry for `cacheKey`
+// and returns the patched value. The patched document must decode into T without unknown fields,
+// otherwise the entry is left unchanged. The update happens under the entry lock, taken with the
+// configured Locker or with a LockFileLocker if none is configured (see WithLocker), so concurrent
+// patches of the same entry do not lose updates. The result is written atomically. ErrNotCached is
+// returned if there is no fresh entry.
+func PatchCache[T any](cacheKey string, cacheDir string, patch []byte, opts ...Option) (T, error) {
+	var data T
+	o := newOptionsFor[T](opts)
+	if o.err != nil {
+		return data, o.err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	var patchDoc any
+	if err := decodeJSON(patch, &patchDoc); err != nil {
+		return data, fmt.Errorf("error parsing merge patch: %w", err)
+	}
+
+	unlock, err := lockEntryExclusive(context.Background(), cacheFilePath, o)
+	if err != nil {
+		return data, fmt.Errorf("error locking cache entry: %w", err)
+	}
+	defer unlock()
+
+	info, err := statEntry(cacheFilePath, o)
+	if err != nil || !isFresh(info, o.ttl) {
+		return data, ErrNotCached
+	}
+	fileData, err := readEntry(cacheFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, ErrNotCached
+	}
+	if err != nil {
+		return data, fmt.Errorf("error reading cache file: %w", err)
+	}
+	var doc any
+	if err := decodeJSON(fileData, &doc); err != nil {
+		return data, fmt.Errorf("error parsing cache file JSON: %w", err)
+	}
+
+	patchedBytes, err := json.Marshal(mergePatch(doc, patchDoc))
+	if err != nil {
+		return data, fmt.Errorf("error marshaling patched data to JSON: %w", err)
+	}
+
+	// Validate the patched document by decoding it into T
+	dec := json.NewDecoder(bytes.NewReader(patchedBytes))
+	dec.DisallowUnknownFields()
+	var patched T
+	if err := dec.Decode(&patched); err != nil {
+		return data, fmt.Errorf("patched data does not decode into %T: %w", data, err)
+	}
+	data = patched
+
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return data, fmt.Errorf("error marshaling data to JSON: %w", err)
+	}
+
+	if err := writeEntry(cacheKey, cacheFilePath, dataBytes, o); err != nil {
+		return data, fmt.Errorf("error writing cache file: %w", err)
+	}
+	o.trackExpiry(cacheKey, cacheFilePath)
+
+	return data, nil
+}
+
+// mergePatch applies the merge patch to target as described in RFC 7396, section 2.
+func mergePatch(target any, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+		} else {
+			targetObj[name] = mergePatch(targetObj[name], value)
+		}
+	}
+	return targetObj
+}
+
+// decodeJSON decodes data into v keeping numbers as json.Number, so they survive re-encoding unchanged.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
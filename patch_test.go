@@ -0,0 +1,116 @@
+package get_with_cache_go
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples of RFC 7396, appendix A
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"n":12345678901234567890}`, `{"m":1}`, `{"m":1,"n":12345678901234567890}`},
+	}
+	for _, tt := range tests {
+		var target, patch any
+		if err := decodeJSON([]byte(tt.target), &target); err != nil {
+			t.Fatal(err)
+		}
+		if err := decodeJSON([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(mergePatch(target, patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+type patchedUser struct {
+	Name  string   `json:"name"`
+	Email string   `json:"email,omitempty"`
+	Tags  []string `json:"tags"`
+}
+
+func TestPatchCache(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := PatchCache[patchedUser]("user", dir, []byte(`{"name":"b"}`)); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("patch of a missing entry: got %v, want %v", err, ErrNotCached)
+	}
+
+	if _, err := CompareAndSwap("user", dir, "", patchedUser{Name: "a", Email: "a@example.com", Tags: []string{"x"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := PatchCache[patchedUser]("user", dir, []byte(`{"name":"b","email":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := patchedUser{Name: "b", Tags: []string{"x"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// Patches producing fields T does not have leave the entry unchanged
+	if _, err := PatchCache[patchedUser]("user", dir, []byte(`{"unknown":1}`)); err == nil {
+		t.Fatal("patch adding an unknown field succeeded")
+	}
+	stored, _, err := ReadWithVersion[patchedUser]("user", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, want) {
+		t.Fatalf("stored %+v, want %+v", stored, want)
+	}
+}
+
+func TestPatchCacheConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CompareAndSwap("counts", dir, "", map[string]int{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without WithLocker the patches are still serialized, none of them is lost
+	const patches = 16
+	var wg sync.WaitGroup
+	for i := range patches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			patch, _ := json.Marshal(map[string]int{string(rune('a' + i)): i})
+			if _, err := PatchCache[map[string]int]("counts", dir, patch); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	counts, _, err := ReadWithVersion[map[string]int]("counts", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != patches {
+		t.Fatalf("got %d fields, want %d", len(counts), patches)
+	}
+}
@@ -0,0 +1,75 @@
+package get_with_cache_go
+
+import (
+	"reflect"
+	"time"
+)
+
+// TTLPolicy can be implemented by cached value types to declare their WithTTL option.
+// Like the other policy interfaces, it is called on the zero value of the type (or a pointer to it),
+// and options passed to a call override the declared policy.
+type TTLPolicy interface {
+	CacheTTL() time.Duration
+}
+
+// NamespacePolicy can be implemented by cached value types to declare their WithNamespace option.
+type NamespacePolicy interface {
+	CacheNamespace() string
+}
+
+// SchemaVersionPolicy can be implemented by cached value types to declare their WithSchemaVersion option.
+type SchemaVersionPolicy interface {
+	CacheSchemaVersion() int
+}
+
+// CacheablePolicy can be implemented by cached value types to keep individual values out of the cache.
+// Unlike the other policy interfaces it is called on the fetched value.
+type CacheablePolicy interface {
+	Cacheable() bool
+}
+
+// typePolicy returns the options declared by the policy interfaces implemented by T or *T.
+// For a pointer type T they are read through a pointer to the zero value of the element type,
+// as policy methods with value receivers cannot be called through a nil pointer.
+func typePolicy[T any]() []Option {
+	var zero T
+	v := reflect.ValueOf(&zero)
+	if t := reflect.TypeFor[T](); t.Kind() == reflect.Pointer {
+		v = reflect.New(t.Elem())
+	}
+
+	var policy []Option
+	if p, ok := implementation[TTLPolicy](v); ok {
+		policy = append(policy, WithTTL(p.CacheTTL()))
+	}
+	if p, ok := implementation[NamespacePolicy](v); ok {
+		policy = append(policy, WithNamespace(p.CacheNamespace()))
+	}
+	if p, ok := implementation[SchemaVersionPolicy](v); ok {
+		policy = append(policy, WithSchemaVersion(p.CacheSchemaVersion()))
+	}
+	return policy
+}
+
+// isCacheable reports whether data may be stored, according to CacheablePolicy.
+// A nil pointer has no policy and may be stored.
+func isCacheable[T any](data *T) bool {
+	p, ok := implementation[CacheablePolicy](reflect.ValueOf(data))
+	return !ok || p.Cacheable()
+}
+
+// implementation returns the value ptr points to, or ptr itself, as an I, whichever implements it.
+// A nil pointer value implements nothing, so that no method is called through it.
+func implementation[I any](ptr reflect.Value) (I, bool) {
+	elem := ptr.Elem()
+	if elem.Kind() == reflect.Interface {
+		elem = elem.Elem()
+	}
+	if elem.IsValid() && !(elem.Kind() == reflect.Pointer && elem.IsNil()) {
+		if i, ok := elem.Interface().(I); ok {
+			return i, true
+		}
+	}
+	i, ok := ptr.Interface().(I)
+	return i, ok
+}
@@ -0,0 +1,95 @@
+package get_with_cache_go
+
+import (
+	"testing"
+	"time"
+)
+
+type valuePolicy struct {
+	Name string `json:"name"`
+}
+
+func (valuePolicy) CacheTTL() time.Duration { return time.Minute }
+func (valuePolicy) CacheNamespace() string  { return "values" }
+func (valuePolicy) CacheSchemaVersion() int { return 2 }
+func (v valuePolicy) Cacheable() bool       { return v.Name != "" }
+
+type pointerPolicy struct{}
+
+func (*pointerPolicy) CacheNamespace() string { return "pointers" }
+
+func TestTypePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		o         *options
+		ttl       time.Duration
+		namespace string
+		version   int
+	}{
+		{"value", newOptionsFor[valuePolicy](nil), time.Minute, "values", 2},
+		{"pointer to value receivers", newOptionsFor[*valuePolicy](nil), time.Minute, "values", 2},
+		{"pointer receivers", newOptionsFor[pointerPolicy](nil), 0, "pointers", 0},
+		{"pointer to pointer receivers", newOptionsFor[*pointerPolicy](nil), 0, "pointers", 0},
+		{"no policy", newOptionsFor[map[string]int](nil), 0, "", 0},
+		{"overridden", newOptionsFor[valuePolicy]([]Option{WithNamespace("other")}), time.Minute, "other", 2},
+	}
+	for _, tt := range tests {
+		if tt.o.ttl != tt.ttl || tt.o.namespace != tt.namespace || tt.o.schemaVersion != tt.version {
+			t.Errorf("%s: got ttl %s, namespace %q, version %d", tt.name, tt.o.ttl, tt.o.namespace, tt.o.schemaVersion)
+		}
+	}
+}
+
+func TestIsCacheable(t *testing.T) {
+	named, unnamed := valuePolicy{Name: "a"}, valuePolicy{}
+	var nilPointer *valuePolicy
+	var nilInterface any = nilPointer
+
+	if !isCacheable(&named) || isCacheable(&unnamed) {
+		t.Error("Cacheable of values not honoured")
+	}
+	if p := &named; !isCacheable(&p) {
+		t.Error("Cacheable of pointers not honoured")
+	}
+	if !isCacheable(&nilPointer) || !isCacheable(&nilInterface) {
+		t.Error("nil pointers must be cacheable")
+	}
+}
+
+func TestFetchPointerWithValuePolicy(t *testing.T) {
+	dir := t.TempDir()
+	got, err := FetchDataWithCache(func() (*valuePolicy, error) { return nil, nil }, "key", dir)
+	if err != nil || got != nil {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	want := &valuePolicy{Name: "a"}
+	if _, err := FetchDataWithCache(func() (*valuePolicy, error) { return want, nil }, "other", dir); err != nil {
+		t.Fatal(err)
+	}
+	cached, _, err := ReadWithVersion[*valuePolicy]("other", dir)
+	if err != nil || *cached != *want {
+		t.Fatalf("got %v, %v", cached, err)
+	}
+}
+
+func TestSchemaVersionsDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := FetchDataWithCache(func() (string, error) { return "unversioned", nil }, "api.v2", dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FetchDataWithCache(func() (string, error) { return "versioned", nil }, "api", dir, WithSchemaVersion(2))
+	if err != nil || got != "versioned" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	for version, want := range map[int]string{0: "api.v2", 2: "api"} {
+		keys, err := ListKeys(dir, WithSchemaVersion(version))
+		if err != nil || len(keys) != 1 || keys[0] != want {
+			t.Errorf("version %d: got keys %v, %v", version, keys, err)
+		}
+	}
+	if err := validateNamespace("@v2"); err == nil {
+		t.Error("namespace colliding with a schema version accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	defaultPrefetchPerFetch    = 10
+	defaultPrefetchConcurrency = 8
+)
+
+// defaultPrefetchSlots limits the prefetches running at once for fetches without WithPrefetchLimits.
+var defaultPrefetchSlots = make(chan struct{}, defaultPrefetchConcurrency)
+
+// inflightPrefetches holds the cache keys currently being prefetched.
+var inflightPrefetches sync.Map
+
+// Association is a cache entry related to a fetched one, which is prefetched in the background.
+type Association struct {
+	// CacheKey identifies the related entry. Prefetches of a key already being prefetched are skipped.
+	CacheKey string
+	// Fetch loads the related entry, typically by calling FetchDataWithCache with its own getDataFunc.
+	Fetch func(ctx context.Context) error
+}
+
+// StaticAssociations returns an association function for WithAssociations that always
+// returns `associations`, whatever the fetched value.
+func StaticAssociations(associations ...Association) func(value any) []Association {
+	return func(any) []Association {
+		return associations
+	}
+}
+
+// WithAssociations declares entries related to the fetched one. After every successful fetch,
+// from the cache or not, `associations` is called with the value and the returned entries are
+// prefetched in background goroutines, within the limits set by WithPrefetchLimits.
+// Errors of prefetches are ignored.
+func WithAssociations(associations func(value any) []Association) Option {
+	return func(o *options) {
+		o.associations = associations
+	}
+}
+
+// WithPrefetchLimits limits prefetching of associations: at most `perFetch` associations are
+// prefetched per fetch, and at most `concurrency` prefetches run at once across all fetches
+// sharing the returned Option. Associations beyond the limits are not prefetched.
+// Without it, 10 associations per fetch and 8 concurrent prefetches per process are allowed.
+func WithPrefetchLimits(perFetch int, concurrency int) Option {
+	slots := make(chan struct{}, max(concurrency, 0))
+	return func(o *options) {
+		o.prefetchPerFetch = perFetch
+		o.prefetchSlots = slots
+	}
+}
+
+// prefetchAssociations starts the prefetches of the associations of value.
+func (o *options) prefetchAssociations(value any) {
+	if o.associations == nil {
+		return
+	}
+
+	associations := o.associations(value)
+	if len(associations) > o.prefetchPerFetch {
+		associations = associations[:max(o.prefetchPerFetch, 0)]
+	}
+	for _, a := range associations {
+		select {
+		case o.prefetchSlots <- struct{}{}:
+		default:
+			// Too many prefetches running already
+			return
+		}
+		if _, running := inflightPrefetches.LoadOrStore(a.CacheKey, struct{}{}); running {
+			<-o.prefetchSlots
+			continue
+		}
+
+		go func(a Association, slots chan struct{}) {
+			defer func() { <-slots }()
+			defer inflightPrefetches.Delete(a.CacheKey)
+			_ = a.Fetch(context.Background())
+		}(a, o.prefetchSlots)
+	}
+}
@@ -0,0 +1,89 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// blockingAssociations returns n associations with keys `<prefix>-<i>`, whose fetches are counted
+// and block until release is closed.
+func blockingAssociations(prefix string, n int, fetches *atomic.Int64, release <-chan struct{}) []Association {
+	associations := make([]Association, n)
+	for i := range associations {
+		associations[i] = Association{
+			CacheKey: prefix + "-" + strconv.Itoa(i),
+			Fetch: func(context.Context) error {
+				fetches.Add(1)
+				<-release
+				return nil
+			},
+		}
+	}
+	return associations
+}
+
+// fetchWithAssociations fetches a cached value, which prefetches associations within limits.
+func fetchWithAssociations(t *testing.T, dir string, associations []Association, limits Option) {
+	t.Helper()
+	_, err := FetchDataWithCache(func() (int, error) { return 1, nil }, "key", dir,
+		WithAssociations(StaticAssociations(associations...)), limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrefetchLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		perFetch    int
+		concurrency int
+		want        int64
+	}{
+		{"per fetch", 2, 10, 2},
+		{"concurrency", 10, 3, 3},
+		{"disabled", 0, 10, 0},
+	}
+	for _, tt := range tests {
+		var fetches atomic.Int64
+		release := make(chan struct{})
+		limits := WithPrefetchLimits(tt.perFetch, tt.concurrency)
+		slots := newOptions([]Option{limits}).prefetchSlots
+
+		fetchWithAssociations(t, t.TempDir(), blockingAssociations("limits-"+tt.name, 5, &fetches, release), limits)
+		if running := len(slots); running != int(tt.want) {
+			t.Errorf("%s: %d prefetches running, want %d", tt.name, running, tt.want)
+		}
+		close(release)
+		eventually(t, func() bool { return len(slots) == 0 }, "prefetches to finish")
+		if n := fetches.Load(); n != tt.want {
+			t.Errorf("%s: %d prefetches, want %d", tt.name, n, tt.want)
+		}
+	}
+}
+
+func TestPrefetchDeduplication(t *testing.T) {
+	dir := t.TempDir()
+	var fetches atomic.Int64
+	release := make(chan struct{})
+	associations := blockingAssociations("dedup", 1, &fetches, release)
+	limits := WithPrefetchLimits(10, 10)
+	slots := newOptions([]Option{limits}).prefetchSlots
+
+	// The key is still being prefetched for the first fetch when the second one associates it
+	fetchWithAssociations(t, dir, associations, limits)
+	fetchWithAssociations(t, dir, associations, limits)
+	if running := len(slots); running != 1 {
+		t.Errorf("%d prefetches running, want 1", running)
+	}
+	close(release)
+	eventually(t, func() bool { return len(slots) == 0 }, "the prefetch to finish")
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d prefetches of the same key, want 1", n)
+	}
+
+	// Once done, the key is prefetched again
+	fetchWithAssociations(t, dir, associations, limits)
+	eventually(t, func() bool { return fetches.Load() == 2 }, "the key to be prefetched again")
+}
@@ -0,0 +1,87 @@
+package get_with_cache_go
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// privateKeys derives file names and key encryption from a secret, see WithPrivateKeys.
+type privateKeys struct {
+	nameKey []byte
+	aead    cipher.AEAD
+}
+
+// WithPrivateKeys names cache files by the hex encoded HMAC-SHA256 of the cache key instead of
+// the key itself, so that keys containing personal data do not show up in directory listings
+// or backups. The original key is stored next to the entry in a `.key` file, encrypted with
+// AES-GCM, and can be recovered with ListKeys by holders of the secret.
+// All calls accessing an entry must use the same secret.
+func WithPrivateKeys(secret []byte) Option {
+	encKey := deriveKey(secret, "encryption")
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		// Unreachable, deriveKey returns a valid AES-256 key
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	pk := &privateKeys{nameKey: deriveKey(secret, "filename"), aead: aead}
+
+	return func(o *options) {
+		o.privateKeys = pk
+	}
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func (pk *privateKeys) fileName(cacheKey string) string {
+	mac := hmac.New(sha256.New, pk.nameKey)
+	mac.Write([]byte(cacheKey))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (pk *privateKeys) writeKeyFile(path string, cacheKey string) error {
+	nonce := make([]byte, pk.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return writeFileAtomic(keyPath(path), pk.aead.Seal(nonce, nonce, []byte(cacheKey), nil))
+}
+
+// readKeyFile returns the original cache key of the entry at path.
+func (pk *privateKeys) readKeyFile(path string) (string, error) {
+	sealed, err := os.ReadFile(keyPath(path))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < pk.aead.NonceSize() {
+		return "", errors.New("key file too short")
+	}
+	cacheKey, err := pk.aead.Open(nil, sealed[:pk.aead.NonceSize()], sealed[pk.aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	// Guard against key files copied next to another entry
+	if !strings.HasPrefix(filepath.Base(path), pk.fileName(string(cacheKey))+".") {
+		return "", errors.New("key file does not belong to entry")
+	}
+	return string(cacheKey), nil
+}
+
+func keyPath(path string) string {
+	return path + ".key"
+}
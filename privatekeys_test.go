@@ -0,0 +1,78 @@
+package get_with_cache_go
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrivateKeys(t *testing.T) {
+	dir := t.TempDir()
+	private := WithPrivateKeys([]byte("secret"))
+	keys := []string{"user/bob", "user:alice@example.com"}
+	if _, err := FetchDataWithCache(func() (int, error) { return 1, nil }, keys[0], dir, private); err != nil {
+		t.Fatal(err)
+	}
+	// Chunked entries are listed by their manifest
+	if _, err := FetchDataWithCache(func() (string, error) { return strings.Repeat("x", 100), nil }, keys[1], dir,
+		private, WithChunkSize(16)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(manifestPath(entryPath(dir, "user:alice@example.com", newOptions([]Option{private})))); err != nil {
+		t.Fatalf("entry not chunked: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.Contains(f.Name(), "alice") || strings.Contains(f.Name(), "bob") {
+			t.Errorf("file name %s reveals a key", f.Name())
+		}
+	}
+
+	if got, err := ListKeys(dir, private); err != nil || strings.Join(got, ",") != strings.Join(keys, ",") {
+		t.Fatalf("got keys %q, %v", got, err)
+	}
+	if got, err := ListKeys(dir, WithPrivateKeys([]byte("other"))); err != nil || len(got) != 0 {
+		t.Fatalf("other secret: got keys %q, %v", got, err)
+	}
+	if got, err := ListKeys(dir); err != nil || len(got) != 2 || strings.Contains(strings.Join(got, ","), "alice") {
+		t.Fatalf("without private keys: got keys %q, %v", got, err)
+	}
+
+	if err := Invalidate("user:alice@example.com", dir, private); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ListKeys(dir, private); err != nil || strings.Join(got, ",") != "user/bob" {
+		t.Fatalf("after Invalidate: got keys %q, %v", got, err)
+	}
+	if remaining, _ := filepath.Glob(filepath.Join(dir, "*")); len(remaining) != 3 {
+		t.Errorf("files of the invalidated entry left: %v", remaining)
+	}
+}
+
+func TestPrivateKeysMovedKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	private := WithPrivateKeys([]byte("secret"))
+	o := newOptions([]Option{private})
+	for _, key := range []string{"a", "b"} {
+		if _, err := FetchDataWithCache(func() (int, error) { return 1, nil }, key, dir, private); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The key file of a next to the entry of b must not make b show up as a
+	sealed, err := os.ReadFile(keyPath(entryPath(dir, "a", o)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath(entryPath(dir, "b", o)), sealed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ListKeys(dir, private); err != nil || strings.Join(got, ",") != "a" {
+		t.Fatalf("got keys %q, %v", got, err)
+	}
+}
@@ -0,0 +1,254 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheableStatus lists the status codes that are cacheable by default (RFC 9110, section 15.1).
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// cachedResponse is the cache entry stored for a handler response.
+type cachedResponse struct {
+	Status int           `json:"status"`
+	Header http.Header   `json:"header"`
+	Body   []byte        `json:"body"`
+	TTL    time.Duration `json:"ttl"`
+}
+
+// ResponseCacheMiddleware returns net/http middleware that caches GET and HEAD responses of the
+// wrapped handler in `cacheDir`. Responses are keyed by method, path, query and the values of
+// `varyHeaders` in the request.
+//
+// The lifetime of a response is taken from the s-maxage or max-age directive of the Cache-Control
+// header set by the handler, falling back to WithTTL. Responses marked no-store, no-cache or private,
+// responses setting cookies and responses without a lifetime are not cached. Cache-Control headers
+// of incoming requests are honoured as in CacheControlMiddleware. Conditional requests matching the
+// ETag or Last-Modified of a response are answered with 304 Not Modified. Stored responses and
+// cacheable 200 responses get an ETag computed from the body unless the handler set one.
+//
+// Requests carrying an Authorization header, or cookies unless Cookie is one of `varyHeaders`, bypass
+// the cache, as responses to them are personalised (RFC 9111, section 3.5). Only responses that
+// the handler marks public, s-maxage or must-revalidate are stored for and served to such requests.
+//
+// An error is returned if an option is invalid, such as a namespace outside of `cacheDir`.
+func ResponseCacheMiddleware(cacheDir string, varyHeaders []string, opts ...Option) (func(http.Handler) http.Handler, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			d := parseCacheControl(r.Header.Get("Cache-Control"))
+			cacheKey := responseCacheKey(r, varyHeaders)
+			cacheFilePath := entryPath(cacheDir, cacheKey, o)
+			credentialed := hasCredentials(r, varyHeaders)
+
+			// Serve a cached response if there is a fresh one
+			if d.Mode != CacheModeNoCache && d.Mode != CacheModeNoStore {
+				if resp, info, ok := readCachedResponse(cacheFilePath, o); ok && isFresh(info, resp.TTL) && isFresh(info, d.MaxAge) &&
+					(!credentialed || sharedResponse(resp.Header)) {
+					w.Header().Set("Age", strconv.Itoa(int(entryAge(info).Seconds())))
+					serveResponse(w, r, resp)
+					return
+				}
+			}
+
+			if d.Mode == CacheModeOnlyIfCached {
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+
+			rec := &responseRecorder{header: http.Header{}}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			resp := &cachedResponse{
+				Status: rec.status,
+				Header: rec.header,
+				Body:   rec.body.Bytes(),
+				TTL:    responseTTL(rec, o.ttl),
+			}
+			store := d.Mode != CacheModeNoStore && resp.TTL > 0 && (!credentialed || sharedResponse(resp.Header))
+			// Responses that are neither stored nor cacheable must not be revalidated against their body
+			if resp.Header.Get("ETag") == "" && (store || resp.Status == http.StatusOK && resp.TTL > 0) {
+				resp.Header.Set("ETag", strconv.Quote(sha256Hex(resp.Body)[:32]))
+			}
+
+			if store {
+				// Failing to store the response must not fail the request
+				if dataBytes, err := json.Marshal(resp); err == nil {
+					_ = writeEntry(cacheKey, cacheFilePath, dataBytes, o)
+				}
+			}
+
+			serveResponse(w, r, resp)
+		})
+	}, nil
+}
+
+// responseCacheKey derives the cache key of the response to r.
+func responseCacheKey(r *http.Request, varyHeaders []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method + "\n" + r.URL.Path + "\n" + r.URL.RawQuery)
+	for _, h := range varyHeaders {
+		b.WriteString("\n" + http.CanonicalHeaderKey(h) + ":" + strings.Join(r.Header.Values(h), ","))
+	}
+	return "http-" + sha256Hex([]byte(b.String()))
+}
+
+// hasCredentials reports whether r carries an Authorization header, or cookies that are not part
+// of the cache key.
+func hasCredentials(r *http.Request, varyHeaders []string) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	if r.Header.Get("Cookie") == "" {
+		return false
+	}
+	for _, h := range varyHeaders {
+		if http.CanonicalHeaderKey(h) == "Cookie" {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedResponse reports whether the Cache-Control header of a response allows storing it for
+// requests with credentials (RFC 9111, section 3.5).
+func sharedResponse(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "public", "s-maxage", "must-revalidate":
+			return true
+		}
+	}
+	return false
+}
+
+func readCachedResponse(path string, o *options) (*cachedResponse, os.FileInfo, bool) {
+	info, err := statEntry(path, o)
+	if err != nil {
+		return nil, nil, false
+	}
+	fileData, err := readEntry(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	var resp cachedResponse
+	if err := json.Unmarshal(fileData, &resp); err != nil {
+		return nil, nil, false
+	}
+	return &resp, info, true
+}
+
+// responseTTL returns how long the recorded response may be cached, or 0 if it must not be cached.
+func responseTTL(rec *responseRecorder, defaultTTL time.Duration) time.Duration {
+	if !cacheableStatus[rec.status] || len(rec.header.Values("Set-Cookie")) > 0 {
+		return 0
+	}
+
+	ttl := defaultTTL
+	sharedMaxAge := false
+	for _, directive := range strings.Split(rec.header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0
+		case "max-age", "s-maxage":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || sharedMaxAge {
+				continue
+			}
+			ttl = time.Duration(seconds) * time.Second
+			sharedMaxAge = strings.EqualFold(name, "s-maxage")
+		}
+	}
+	return ttl
+}
+
+// serveResponse writes resp to w, or 304 Not Modified if the request's validators match.
+func serveResponse(w http.ResponseWriter, r *http.Request, resp *cachedResponse) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	if resp.Status == http.StatusOK && notModified(r, resp.Header) {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(resp.Body)
+	}
+}
+
+// notModified evaluates the If-None-Match and If-Modified-Since headers of r against the response header.
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(ims)
+}
+
+// responseRecorder buffers the response written by a handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
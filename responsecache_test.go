@@ -0,0 +1,195 @@
+package get_with_cache_go
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// countingHandler answers with the number of requests it served, setting the given response headers.
+func countingHandler(header http.Header) (http.Handler, *int) {
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		_, _ = w.Write([]byte(strconv.Itoa(calls)))
+	}), &calls
+}
+
+func newResponseCache(t *testing.T, next http.Handler, varyHeaders []string, opts ...Option) http.Handler {
+	t.Helper()
+	middleware, err := ResponseCacheMiddleware(t.TempDir(), varyHeaders, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return middleware(next)
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestResponseCacheStoresCacheableResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		opts   []Option
+		stored bool
+	}{
+		{"max-age", http.MethodGet, http.Header{"Cache-Control": {"max-age=60"}}, nil, true},
+		{"head", http.MethodHead, http.Header{"Cache-Control": {"max-age=60"}}, nil, true},
+		{"default ttl", http.MethodGet, nil, []Option{WithTTL(time.Minute)}, true},
+		{"no lifetime", http.MethodGet, nil, nil, false},
+		{"no-store", http.MethodGet, http.Header{"Cache-Control": {"no-store, max-age=60"}}, nil, false},
+		{"private", http.MethodGet, http.Header{"Cache-Control": {"private, max-age=60"}}, nil, false},
+		{"set-cookie", http.MethodGet, http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}, nil, false},
+		{"post", http.MethodPost, http.Header{"Cache-Control": {"max-age=60"}}, nil, false},
+	}
+	for _, tt := range tests {
+		next, calls := countingHandler(tt.header)
+		h := newResponseCache(t, next, nil, tt.opts...)
+		serve(h, httptest.NewRequest(tt.method, "/a", nil))
+		w := serve(h, httptest.NewRequest(tt.method, "/a", nil))
+
+		if stored := *calls == 1; stored != tt.stored {
+			t.Errorf("%s: handler called %d times, stored %v, want %v", tt.name, *calls, stored, tt.stored)
+		}
+		if tt.stored && w.Header().Get("Age") == "" {
+			t.Errorf("%s: cached response without Age", tt.name)
+		}
+	}
+}
+
+func TestResponseCacheCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		varyHeaders  []string
+		request      http.Header
+		stored       bool
+	}{
+		{"authorization", "max-age=60", nil, http.Header{"Authorization": {"Bearer x"}}, false},
+		{"cookie", "max-age=60", nil, http.Header{"Cookie": {"a=b"}}, false},
+		{"cookie in key", "max-age=60", []string{"Cookie"}, http.Header{"Cookie": {"a=b"}}, true},
+		{"public", "public, max-age=60", nil, http.Header{"Authorization": {"Bearer x"}}, true},
+		{"s-maxage", "s-maxage=60", nil, http.Header{"Authorization": {"Bearer x"}}, true},
+	}
+	for _, tt := range tests {
+		next, calls := countingHandler(http.Header{"Cache-Control": {tt.cacheControl}})
+		h := newResponseCache(t, next, tt.varyHeaders)
+		for range 2 {
+			r := httptest.NewRequest(http.MethodGet, "/a", nil)
+			r.Header = tt.request.Clone()
+			serve(h, r)
+		}
+		if stored := *calls == 1; stored != tt.stored {
+			t.Errorf("%s: handler called %d times, stored %v, want %v", tt.name, *calls, stored, tt.stored)
+		}
+	}
+
+	// A response stored for anonymous requests is not served to credentialed ones
+	next, calls := countingHandler(http.Header{"Cache-Control": {"max-age=60"}})
+	h := newResponseCache(t, next, nil)
+	serve(h, httptest.NewRequest(http.MethodGet, "/a", nil))
+	r := httptest.NewRequest(http.MethodGet, "/a", nil)
+	r.Header.Set("Authorization", "Bearer x")
+	if w := serve(h, r); *calls != 2 || w.Body.String() != "2" {
+		t.Errorf("personalised request served from the cache: %d calls, body %q", *calls, w.Body.String())
+	}
+}
+
+func TestResponseCacheConditionalRequests(t *testing.T) {
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	next, _ := countingHandler(http.Header{
+		"Cache-Control": {"max-age=60"},
+		"Last-Modified": {lastModified.Format(http.TimeFormat)},
+	})
+	h := newResponseCache(t, next, nil)
+	etag := serve(h, httptest.NewRequest(http.MethodGet, "/a", nil)).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("stored response without ETag")
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"matching etag", "If-None-Match", etag, http.StatusNotModified},
+		{"weak etag in list", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"any etag", "If-None-Match", "*", http.StatusNotModified},
+		{"other etag", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", lastModified.Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", "If-Modified-Since", lastModified.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/a", nil)
+		r.Header.Set(tt.header, tt.value)
+		w := serve(h, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s: 304 with body %q", tt.name, w.Body.String())
+		}
+	}
+
+	// Responses that are not cached are not given an ETag
+	next, _ = countingHandler(http.Header{"Cache-Control": {"no-store"}})
+	if w := serve(newResponseCache(t, next, nil), httptest.NewRequest(http.MethodGet, "/a", nil)); w.Header().Get("ETag") != "" {
+		t.Errorf("uncacheable response got ETag %s", w.Header().Get("ETag"))
+	}
+}
+
+func TestResponseTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+	}{
+		{"max-age=60", time.Minute},
+		{"max-age=60, s-maxage=10", 10 * time.Second},
+		{"s-maxage=10, max-age=60", 10 * time.Second},
+		{"s-maxage=10, max-age=0", 10 * time.Second},
+		{"s-maxage=soon, max-age=60", time.Minute},
+		{"", time.Hour},
+		{"s-maxage=10, no-cache", 0},
+	}
+	for _, tt := range tests {
+		rec := &responseRecorder{header: http.Header{"Cache-Control": {tt.cacheControl}}, status: http.StatusOK}
+		if got := responseTTL(rec, time.Hour); got != tt.want {
+			t.Errorf("responseTTL(%q) = %s, want %s", tt.cacheControl, got, tt.want)
+		}
+	}
+}
+
+func TestResponseCacheOnlyIfCached(t *testing.T) {
+	next, calls := countingHandler(http.Header{"Cache-Control": {"max-age=60"}})
+	h := newResponseCache(t, next, nil)
+	onlyIfCached := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/a", nil)
+		r.Header.Set("Cache-Control", "only-if-cached")
+		return serve(h, r)
+	}
+
+	if w := onlyIfCached(); w.Code != http.StatusGatewayTimeout || *calls != 0 {
+		t.Fatalf("miss: got status %d after %d calls, want %d", w.Code, *calls, http.StatusGatewayTimeout)
+	}
+	serve(h, httptest.NewRequest(http.MethodGet, "/a", nil))
+	if w := onlyIfCached(); w.Code != http.StatusOK || w.Body.String() != "1" {
+		t.Fatalf("hit: got status %d, body %q", w.Code, w.Body.String())
+	}
+}
+
+func TestResponseCacheMiddlewareInvalidOption(t *testing.T) {
+	if _, err := ResponseCacheMiddleware(t.TempDir(), nil, WithNamespace("../other")); err == nil {
+		t.Fatal("invalid namespace accepted")
+	}
+}
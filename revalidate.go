@@ -0,0 +1,106 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrNotModified is returned by a RevalidateFunc when the data did not change since the given validator.
+var ErrNotModified = errors.New("not modified")
+
+// RevalidateFunc is a generic type for functions that return a value of type T together with its
+// validator, e.g. a version or ETag. `validator` is the validator of the cached entry, or empty if
+// there is none. If the data did not change since then, the function returns ErrNotModified.
+type RevalidateFunc[T any] func(validator string) (T, string, error)
+
+// FetchDataWithRevalidation works like FetchDataWithCache for upstreams that can cheaply tell that
+// data did not change. Once the cached entry is stale (see WithTTL), `revalidate` is called with the
+// entry's validator. If it returns ErrNotModified, the expiry of the entry is extended without
+// rewriting it, unless the entry cannot be read anymore, in which case `revalidate` is called again
+// without a validator. Otherwise the new value and validator are stored.
+func FetchDataWithRevalidation[T any](revalidate RevalidateFunc[T], cacheKey string, cacheDir string, opts ...Option) (T, error) {
+	o := newOptionsFor[T](opts)
+	if o.err != nil {
+		var data T
+		return data, o.err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	if data, ok, err := readCached[T](cacheFilePath, o, Directives{}); ok || err != nil {
+		if ok {
+			o.trackExpiry(cacheKey, cacheFilePath)
+		}
+		return data, err
+	}
+
+	unlock, err := lockEntry(context.Background(), cacheFilePath, o)
+	if err != nil {
+		var data T
+		return data, fmt.Errorf("error locking cache entry: %w", err)
+	}
+	defer unlock()
+
+	// Another process may have revalidated the entry while we were waiting for the lock
+	if data, ok, err := readCached[T](cacheFilePath, o, Directives{}); ok || err != nil {
+		if ok {
+			o.trackExpiry(cacheKey, cacheFilePath)
+		}
+		return data, err
+	}
+
+	validator, err := os.ReadFile(validatorPath(cacheFilePath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		var data T
+		return data, fmt.Errorf("error reading validator: %w", err)
+	}
+
+	data, newValidator, err := revalidate(string(validator))
+	if errors.Is(err, ErrNotModified) && len(validator) > 0 {
+		// The stale entry is still current, make it fresh again
+		if err := touchEntry(cacheFilePath, o); err != nil {
+			return data, fmt.Errorf("error extending cache entry: %w", err)
+		}
+		if cached, ok, err := readCached[T](cacheFilePath, o, Directives{}); ok || err != nil {
+			if ok {
+				o.trackExpiry(cacheKey, cacheFilePath)
+			}
+			return cached, err
+		}
+		// The entry is gone nonetheless, e.g. it lost chunks, so fetch the data unconditionally
+		data, newValidator, err = revalidate("")
+	}
+	if err != nil {
+		return data, fmt.Errorf("error fetching data: %w", err)
+	}
+
+	if !isCacheable(&data) {
+		return data, nil
+	}
+
+	// Marshal the data and save it to cache along with its validator
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return data, fmt.Errorf("error marshaling data to JSON: %w", err)
+	}
+
+	if err := writeEntry(cacheKey, cacheFilePath, dataBytes, o); err != nil {
+		return data, fmt.Errorf("error writing cache file: %w", err)
+	}
+	// writeEntry dropped the validator of the previous version
+	if newValidator != "" {
+		if err := writeFileAtomic(validatorPath(cacheFilePath), []byte(newValidator)); err != nil {
+			return data, fmt.Errorf("error writing validator: %w", err)
+		}
+	}
+	o.trackExpiry(cacheKey, cacheFilePath)
+
+	return data, nil
+}
+
+func validatorPath(path string) string {
+	return path + ".validator"
+}
@@ -0,0 +1,131 @@
+package get_with_cache_go
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upstream is a RevalidateFunc source serving value with validator, recording the validators it got.
+type upstream struct {
+	value      string
+	validator  string
+	validators []string
+}
+
+func (u *upstream) revalidate(validator string) (string, string, error) {
+	u.validators = append(u.validators, validator)
+	if validator != "" && validator == u.validator {
+		return "", "", ErrNotModified
+	}
+	return u.value, u.validator, nil
+}
+
+// expire makes the entry at path older than any TTL used in the tests.
+func expire(t *testing.T, path string) {
+	t.Helper()
+	old := time.Now().Add(-time.Hour)
+	for _, file := range []string{path, manifestPath(path)} {
+		if err := os.Chtimes(file, old, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRevalidateNotModified(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithTTL(time.Minute)}
+	path := entryPath(dir, "key", newOptions(opts))
+	u := &upstream{value: "a", validator: "v1"}
+	if got, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil || got != "a" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	expire(t, path)
+	if got, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil || got != "a" {
+		t.Fatalf("not modified: got %q, %v", got, err)
+	}
+	info, err := statEntry(path, newOptions(opts))
+	if err != nil || !isFresh(info, time.Minute) {
+		t.Fatalf("entry not extended: %v", err)
+	}
+	if validator, err := os.ReadFile(validatorPath(path)); err != nil || string(validator) != "v1" {
+		t.Fatalf("got validator %q, %v", validator, err)
+	}
+
+	// Fresh again, the upstream is not asked
+	if got, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil || got != "a" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if want := []string{"", "v1"}; strings.Join(u.validators, ",") != strings.Join(want, ",") {
+		t.Errorf("got validators %q, want %q", u.validators, want)
+	}
+}
+
+func TestRevalidateModified(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithTTL(time.Minute)}
+	path := entryPath(dir, "key", newOptions(opts))
+	u := &upstream{value: "a", validator: "v1"}
+	if _, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	expire(t, path)
+	u.value, u.validator = "b", "v2"
+	if got, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil || got != "b" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if validator, err := os.ReadFile(validatorPath(path)); err != nil || string(validator) != "v2" {
+		t.Fatalf("got validator %q, %v", validator, err)
+	}
+	if cached, _, err := ReadWithVersion[string]("key", dir, opts...); err != nil || cached != "b" {
+		t.Fatalf("cached %q, %v", cached, err)
+	}
+}
+
+func TestRevalidateNotModifiedWithoutValidator(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithTTL(time.Minute)}
+	if _, err := FetchDataWithCache(func() (string, error) { return "a", nil }, "key", dir, opts...); err != nil {
+		t.Fatal(err)
+	}
+	expire(t, entryPath(dir, "key", newOptions(opts)))
+
+	notModified := func(string) (string, string, error) { return "", "", ErrNotModified }
+	if _, err := FetchDataWithRevalidation(notModified, "key", dir, opts...); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("got %v, want %v", err, ErrNotModified)
+	}
+}
+
+func TestRevalidateNotModifiedEntryLost(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithTTL(time.Minute), WithChunkSize(4)}
+	path := entryPath(dir, "key", newOptions(opts))
+	u := &upstream{value: strings.Repeat("a", 20), validator: "v1"}
+	if _, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Still current upstream, but a chunk went missing locally
+	expire(t, path)
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(chunkPath(path, m, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := FetchDataWithRevalidation(u.revalidate, "key", dir, opts...); err != nil || got != u.value {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if want := []string{"", "v1", ""}; strings.Join(u.validators, ",") != strings.Join(want, ",") {
+		t.Errorf("got validators %q, want %q", u.validators, want)
+	}
+	if cached, _, err := ReadWithVersion[string]("key", dir, opts...); err != nil || cached != u.value {
+		t.Fatalf("cached %q, %v", cached, err)
+	}
+}
@@ -0,0 +1,276 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultScrubBytesPerSecond = 1 << 20
+	defaultScrubInterval       = time.Hour
+	quarantineDir              = ".quarantine"
+)
+
+// scrubRetryDelay is the pause before an entry that failed verification is verified again.
+var scrubRetryDelay = time.Second
+
+// ScrubConfig configures Scrub and StartScrubber.
+type ScrubConfig struct {
+	// BytesPerSecond bounds the rate at which entries are read. Defaults to 1 MiB/s.
+	BytesPerSecond int64
+	// Interval is the pause between two passes of StartScrubber. Defaults to one hour.
+	Interval time.Duration
+	// OnCorrupt, if set, is called for every corrupt entry after it was quarantined.
+	OnCorrupt func(path string, err error)
+	// OnReport, if set, is called by StartScrubber after every pass.
+	OnReport func(report ScrubReport, err error)
+}
+
+// ScrubReport summarizes a scrubber pass.
+type ScrubReport struct {
+	Scrubbed    int
+	Corrupt     int
+	Quarantined int
+	Bytes       int64
+}
+
+// StartScrubber runs Scrub over `cacheDir` in the background, every cfg.Interval,
+// until ctx is cancelled. To scrub a shared cache directory from a single replica,
+// start it from LeaderElector.Run.
+func StartScrubber(ctx context.Context, cacheDir string, cfg ScrubConfig) {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultScrubInterval
+	}
+
+	go func() {
+		for {
+			report, err := Scrub(ctx, cacheDir, cfg)
+			if ctx.Err() != nil {
+				return
+			}
+			if cfg.OnReport != nil {
+				cfg.OnReport(report, err)
+			}
+			if sleepContext(ctx, interval) != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Scrub walks the entries in `cacheDir` at a bounded read rate, verifying checksums and
+// that every entry decodes as JSON. Corrupt entries are moved, with their chunks and indexes,
+// to the `.quarantine` directory in `cacheDir` so that they are fetched again.
+func Scrub(ctx context.Context, cacheDir string, cfg ScrubConfig) (ScrubReport, error) {
+	rate := cfg.BytesPerSecond
+	if rate <= 0 {
+		rate = defaultScrubBytesPerSecond
+	}
+	t := &throttle{rate: rate, start: time.Now()}
+
+	var report ScrubReport
+	err := walkEntries(cacheDir, func(entry string, file string, before fs.FileInfo) error {
+		verifyErr := verifyEntry(ctx, entry, t)
+		if verifyErr != nil && ctx.Err() == nil {
+			// The entry may have been caught between writing its payload and its checksum
+			if sleepContext(ctx, scrubRetryDelay) == nil {
+				verifyErr = verifyEntry(ctx, entry, t)
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		report.Scrubbed++
+		stats.scrubbedEntries.Add(1)
+		if verifyErr == nil {
+			return nil
+		}
+
+		// Entries rewritten or removed during verification are not corrupt
+		if after, err := os.Stat(file); err != nil || !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+			return nil
+		}
+
+		report.Corrupt++
+		stats.corruptEntries.Add(1)
+		if err := quarantine(cacheDir, entry); err != nil {
+			return fmt.Errorf("error quarantining %s: %w", entry, err)
+		}
+		report.Quarantined++
+		stats.quarantinedEntries.Add(1)
+		if cfg.OnCorrupt != nil {
+			cfg.OnCorrupt(entry, verifyErr)
+		}
+		return nil
+	})
+	report.Bytes = t.total
+	return report, err
+}
+
+// verifyEntry reads the entry at path through t and checks its checksums and JSON syntax.
+// Single-file entries written before checksum files were introduced only get the syntax check.
+func verifyEntry(ctx context.Context, path string, t *throttle) error {
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		sum, err := os.ReadFile(checksumPath(path))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		h := sha256.New()
+		r := io.TeeReader(&throttledReader{ctx: ctx, r: f, t: t}, h)
+		if err := validateJSON(r); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		if sum != nil && hex.EncodeToString(h.Sum(nil)) != string(sum) {
+			return errors.New("checksum mismatch")
+		}
+		return nil
+	}
+
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+
+	// Stream the chunks into the JSON validator, verifying checksums on the way
+	pr, pw := io.Pipe()
+	validated := make(chan error, 1)
+	go func() {
+		err := validateJSON(pr)
+		_, _ = io.Copy(io.Discard, pr)
+		validated <- err
+	}()
+
+	total := sha256.New()
+	var chunkErr error
+	for i, sum := range m.Chunks {
+		chunk, err := readThrottled(ctx, chunkPath(path, m, i), t)
+		if err != nil {
+			chunkErr = fmt.Errorf("error reading chunk %d: %w", i, err)
+			break
+		}
+		if sha256Hex(chunk) != sum {
+			chunkErr = fmt.Errorf("chunk %d checksum mismatch", i)
+			break
+		}
+		total.Write(chunk)
+		if _, err := pw.Write(chunk); err != nil {
+			break
+		}
+	}
+	if chunkErr == nil && hex.EncodeToString(total.Sum(nil)) != m.SHA256 {
+		chunkErr = errors.New("checksum mismatch")
+	}
+	pw.CloseWithError(chunkErr)
+	return errors.Join(chunkErr, <-validated)
+}
+
+func readThrottled(ctx context.Context, path string, t *throttle) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(&throttledReader{ctx: ctx, r: f, t: t})
+}
+
+// validateJSON checks that r contains exactly one syntactically valid JSON value,
+// without holding the whole value in memory.
+func validateJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	values, depth := 0, 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			if depth == 0 {
+				values++
+			}
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		default:
+			if depth == 0 {
+				values++
+			}
+		}
+	}
+	if values != 1 || depth != 0 {
+		return errors.New("entry is not a single JSON value")
+	}
+	return nil
+}
+
+// quarantine moves the files of the entry at path into the quarantine directory of cacheDir,
+// keeping their path relative to cacheDir.
+func quarantine(cacheDir string, path string) error {
+	target := filepath.Join(cacheDir, quarantineDir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	for _, file := range entryFiles(path) {
+		rel, err := filepath.Rel(cacheDir, file)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(target, rel)), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(file, filepath.Join(target, rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttle limits the rate of reads shared by a scrubber pass.
+type throttle struct {
+	rate  int64
+	start time.Time
+	total int64
+}
+
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	t   *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > tr.t.rate {
+		p = p[:tr.t.rate]
+	}
+	n, err := tr.r.Read(p)
+	tr.t.total += int64(n)
+
+	// Sleep until the bytes read so far are within the rate
+	ahead := time.Duration(float64(tr.t.total)/float64(tr.t.rate)*float64(time.Second)) - time.Since(tr.t.start)
+	if ahead > 0 {
+		timer := time.NewTimer(ahead)
+		defer timer.Stop()
+		select {
+		case <-tr.ctx.Done():
+			return n, tr.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
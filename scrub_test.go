@@ -0,0 +1,89 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrub(t *testing.T) {
+	scrubRetryDelay = time.Millisecond
+	t.Cleanup(func() { scrubRetryDelay = time.Second })
+
+	dir := t.TempDir()
+	o := newOptions(nil)
+	for _, key := range []string{"good", "corrupt"} {
+		if _, err := CompareAndSwap(key, dir, "", map[string]string{"key": key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := CompareAndSwap("chunked", dir, "", strings.Repeat("x", 100), WithChunkSize(16)); err != nil {
+		t.Fatal(err)
+	}
+	// Entries written before checksum files were introduced
+	if err := os.WriteFile(entryPath(dir, "legacy", o), []byte(`{"key":"legacy"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Valid JSON, but not what the checksum was computed from
+	corrupt := entryPath(dir, "corrupt", o)
+	if err := os.WriteFile(corrupt, []byte(`{"key":"CORRUPT"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chunked := entryPath(dir, "chunked", o)
+	m, err := readManifest(chunked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(chunkPath(chunked, m, 1), []byte(strings.Repeat("y", 16)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := GetStats()
+	var reported []string
+	report, err := Scrub(context.Background(), dir, ScrubConfig{
+		BytesPerSecond: 1 << 30,
+		OnCorrupt:      func(path string, err error) { reported = append(reported, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scrubbed != 4 || report.Corrupt != 2 || report.Quarantined != 2 || report.Bytes == 0 {
+		t.Errorf("got report %+v", report)
+	}
+	sort.Strings(reported)
+	if len(reported) != 2 || reported[0] != chunked || reported[1] != corrupt {
+		t.Errorf("OnCorrupt called for %v", reported)
+	}
+
+	after := GetStats()
+	if after.ScrubbedEntries-before.ScrubbedEntries != 4 || after.CorruptEntries-before.CorruptEntries != 2 ||
+		after.QuarantinedEntries-before.QuarantinedEntries != 2 {
+		t.Errorf("stats changed from %+v to %+v", before, after)
+	}
+
+	// Corrupt entries are moved to the quarantine with all their files, and fetched again
+	for _, file := range []string{corrupt, checksumPath(corrupt), manifestPath(chunked), chunkDir(chunked)} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s not quarantined: %v", file, err)
+		}
+	}
+	quarantined, _ := filepath.Glob(filepath.Join(dir, quarantineDir, "*", "*"))
+	if len(quarantined) != 4 {
+		t.Errorf("got quarantined files %v", quarantined)
+	}
+	for _, key := range []string{"corrupt", "chunked"} {
+		if _, _, err := ReadWithVersion[any](key, dir); err == nil {
+			t.Errorf("%s still cached", key)
+		}
+	}
+	for _, key := range []string{"good", "legacy"} {
+		if got, _, err := ReadWithVersion[map[string]string](key, dir); err != nil || got["key"] != key {
+			t.Errorf("%s: got %v, %v", key, got, err)
+		}
+	}
+}
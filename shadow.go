@@ -0,0 +1,114 @@
+package get_with_cache_go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+)
+
+const defaultShadowConcurrency = 4
+
+// ShadowConfig configures WithShadowFetch.
+type ShadowConfig struct {
+	// Rate is the fraction of cache hits, between 0 and 1, that are also fetched in the background.
+	Rate float64
+	// Refresh, if true, replaces diverged entries with the fetched value.
+	Refresh bool
+	// OnDivergence, if set, is called with the JSON encodings of the cached and the fetched
+	// value when they differ.
+	OnDivergence func(cacheKey string, cached []byte, fetched []byte)
+	// OnError, if set, is called when a shadow fetch fails.
+	OnError func(cacheKey string, err error)
+	// MaxConcurrent limits the shadow fetches running at once across all fetches sharing the
+	// Option. Sampled hits beyond the limit are dropped. Defaults to 4.
+	MaxConcurrent int
+}
+
+// WithShadowFetch detects drift between the cache and its source. On a sampled fraction of cache
+// hits, FetchDataWithCache returns the cached value as usual but also calls getDataFunc in the
+// background and compares the JSON encodings of both values. Results are counted in Stats and
+// reported through the hooks of cfg.
+func WithShadowFetch(cfg ShadowConfig) Option {
+	concurrency := cfg.MaxConcurrent
+	if concurrency <= 0 {
+		concurrency = defaultShadowConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	return func(o *options) {
+		o.shadow = &cfg
+		o.shadowSlots = slots
+	}
+}
+
+// shadowFetch samples the cache hit of cached for a background comparison with getDataFunc.
+func shadowFetch[T any](getDataFunc GetDataFunc[T], cached T, cacheKey string, cacheFilePath string, o *options) {
+	cfg := o.shadow
+	if cfg == nil || rand.Float64() >= cfg.Rate {
+		return
+	}
+
+	select {
+	case o.shadowSlots <- struct{}{}:
+	default:
+		// Too many shadow fetches running already
+		stats.shadowDrops.Add(1)
+		return
+	}
+
+	// Encode now, the caller owns the value once it is returned
+	cachedBytes, err := json.Marshal(cached)
+	if err != nil {
+		<-o.shadowSlots
+		return
+	}
+
+	go func(slots chan struct{}) {
+		defer func() { <-slots }()
+		stats.shadowFetches.Add(1)
+		fetched, err := getDataFunc()
+		if err != nil {
+			stats.shadowErrors.Add(1)
+			if cfg.OnError != nil {
+				cfg.OnError(cacheKey, err)
+			}
+			return
+		}
+		fetchedBytes, err := json.Marshal(fetched)
+		if err != nil {
+			stats.shadowErrors.Add(1)
+			if cfg.OnError != nil {
+				cfg.OnError(cacheKey, err)
+			}
+			return
+		}
+		if bytes.Equal(cachedBytes, fetchedBytes) {
+			return
+		}
+
+		stats.shadowDivergences.Add(1)
+		if cfg.OnDivergence != nil {
+			cfg.OnDivergence(cacheKey, cachedBytes, fetchedBytes)
+		}
+		if cfg.Refresh && isCacheable(&fetched) {
+			if err := refreshEntry(cacheKey, cacheFilePath, fetchedBytes, o); err != nil && cfg.OnError != nil {
+				cfg.OnError(cacheKey, err)
+			}
+		}
+	}(o.shadowSlots)
+}
+
+// refreshEntry replaces the entry at path with data under the entry lock.
+func refreshEntry(cacheKey string, path string, data []byte, o *options) error {
+	unlock, err := lockEntry(context.Background(), path, o)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := writeEntry(cacheKey, path, data, o); err != nil {
+		return err
+	}
+	o.trackExpiry(cacheKey, path)
+	return nil
+}
@@ -0,0 +1,151 @@
+package get_with_cache_go
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually fails the test if cond does not become true within a second.
+func eventually(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// primeCache stores value for key without shadow fetching.
+func primeCache(t *testing.T, dir string, key string, value int) {
+	t.Helper()
+	if _, err := FetchDataWithCache(func() (int, error) { return value, nil }, key, dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShadowSampling(t *testing.T) {
+	tests := []struct {
+		rate  float64
+		calls int64
+	}{
+		{0, 0},
+		{1, 10},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		primeCache(t, dir, "key", 1)
+
+		var calls atomic.Int64
+		before := GetStats()
+		shadow := WithShadowFetch(ShadowConfig{Rate: tt.rate, MaxConcurrent: 10})
+		for range 10 {
+			got, err := FetchDataWithCache(func() (int, error) { calls.Add(1); return 1, nil }, "key", dir, shadow)
+			if err != nil || got != 1 {
+				t.Fatalf("rate %v: got %d, %v", tt.rate, got, err)
+			}
+		}
+		eventually(t, func() bool { return GetStats().ShadowFetches-before.ShadowFetches == uint64(tt.calls) }, "shadow fetches")
+		if calls.Load() != tt.calls {
+			t.Errorf("rate %v: %d shadow fetches, want %d", tt.rate, calls.Load(), tt.calls)
+		}
+		if diverged := GetStats().ShadowDivergences - before.ShadowDivergences; diverged != 0 {
+			t.Errorf("rate %v: %d divergences of equal values", tt.rate, diverged)
+		}
+	}
+}
+
+func TestShadowDivergence(t *testing.T) {
+	for _, refresh := range []bool{false, true} {
+		dir := t.TempDir()
+		primeCache(t, dir, "key", 1)
+
+		type divergence struct{ key, cached, fetched string }
+		diverged := make(chan divergence, 1)
+		before := GetStats()
+		got, err := FetchDataWithCache(func() (int, error) { return 2, nil }, "key", dir, WithShadowFetch(ShadowConfig{
+			Rate:    1,
+			Refresh: refresh,
+			OnDivergence: func(cacheKey string, cached []byte, fetched []byte) {
+				diverged <- divergence{cacheKey, string(cached), string(fetched)}
+			},
+		}))
+		if err != nil || got != 1 {
+			t.Fatalf("refresh %v: got %d, %v, want the cached value", refresh, got, err)
+		}
+
+		if d := waitFor(t, diverged, "divergence"); d != (divergence{"key", "1", "2"}) {
+			t.Errorf("refresh %v: got divergence %+v", refresh, d)
+		}
+		if n := GetStats().ShadowDivergences - before.ShadowDivergences; n != 1 {
+			t.Errorf("refresh %v: counted %d divergences", refresh, n)
+		}
+
+		want := 1
+		if refresh {
+			want = 2
+		}
+		eventually(t, func() bool {
+			cached, _, err := ReadWithVersion[int]("key", dir)
+			return err == nil && cached == want
+		}, "the cached value")
+	}
+}
+
+func TestShadowErrors(t *testing.T) {
+	dir := t.TempDir()
+	primeCache(t, dir, "key", 1)
+
+	failed := make(chan error, 1)
+	before := GetStats()
+	_, err := FetchDataWithCache(func() (int, error) { return 0, errors.New("unavailable") }, "key", dir, WithShadowFetch(ShadowConfig{
+		Rate:    1,
+		OnError: func(cacheKey string, err error) { failed <- err },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(t, failed, "the shadow fetch to fail"); err.Error() != "unavailable" {
+		t.Errorf("got error %v", err)
+	}
+	if n := GetStats().ShadowErrors - before.ShadowErrors; n != 1 {
+		t.Errorf("counted %d errors", n)
+	}
+}
+
+func TestShadowMaxConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	primeCache(t, dir, "key", 1)
+
+	started, release := make(chan struct{}, 3), make(chan struct{})
+	getData := func() (int, error) {
+		started <- struct{}{}
+		<-release
+		return 1, nil
+	}
+	shadow := WithShadowFetch(ShadowConfig{Rate: 1, MaxConcurrent: 1})
+	before := GetStats()
+	for range 3 {
+		if _, err := FetchDataWithCache(getData, "key", dir, shadow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, started, "the shadow fetch")
+	if n := GetStats().ShadowDrops - before.ShadowDrops; n != 2 {
+		t.Errorf("dropped %d shadow fetches, want 2", n)
+	}
+
+	// The slot is free again once the running shadow fetch is done
+	close(release)
+	slots := newOptions([]Option{shadow}).shadowSlots
+	eventually(t, func() bool { return len(slots) == 0 }, "the slot to be freed")
+	if _, err := FetchDataWithCache(getData, "key", dir, shadow); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, started, "the second shadow fetch")
+	if n := GetStats().ShadowDrops - before.ShadowDrops; n != 2 {
+		t.Errorf("dropped %d shadow fetches, want 2", n)
+	}
+}
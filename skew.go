@@ -0,0 +1,100 @@
+package get_with_cache_go
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// skewMeasurementTTL is how long a measured clock skew is reused before measuring again.
+const skewMeasurementTTL = time.Minute
+
+// WithClockSkewAllowance makes expiry decisions tolerant of clock skew between hosts sharing a
+// cache directory. The offset of the directory's filesystem clock (e.g. of the NFS server setting
+// modification times) from the local clock is measured with a probe file, at most once a minute.
+// If it exceeds `allowance`, entry ages are computed on the filesystem clock instead of the local
+// one, so that all hosts agree on when an entry expires. Measurements are reported in Stats.
+func WithClockSkewAllowance(allowance time.Duration) Option {
+	return func(o *options) {
+		o.skewAllowance = allowance
+	}
+}
+
+// skewedFileInfo translates the modification time of a file to the local clock.
+type skewedFileInfo struct {
+	os.FileInfo
+	skew time.Duration
+}
+
+func (fi skewedFileInfo) ModTime() time.Time {
+	return fi.FileInfo.ModTime().Add(-fi.skew)
+}
+
+type skewMeasurement struct {
+	skew       time.Duration
+	measuredAt time.Time
+}
+
+var skewMeasurements = struct {
+	sync.Mutex
+	dirs map[string]skewMeasurement
+}{dirs: map[string]skewMeasurement{}}
+
+// clockSkew returns the offset of the filesystem clock of dir from the local clock,
+// or 0 if it is within the allowance or skew tolerance is not enabled.
+func (o *options) clockSkew(dir string) time.Duration {
+	if o.skewAllowance <= 0 {
+		return 0
+	}
+
+	skewMeasurements.Lock()
+	m, ok := skewMeasurements.dirs[dir]
+	skewMeasurements.Unlock()
+	if !ok || time.Since(m.measuredAt) > skewMeasurementTTL {
+		skew, err := measureClockSkew(dir)
+		if err != nil {
+			return 0
+		}
+		m = skewMeasurement{skew: skew, measuredAt: time.Now()}
+		skewMeasurements.Lock()
+		skewMeasurements.dirs[dir] = m
+		skewMeasurements.Unlock()
+
+		stats.clockSkew.Store(int64(skew))
+		if skew.Abs() > o.skewAllowance {
+			stats.clockSkewDetections.Add(1)
+		}
+	}
+
+	if m.skew.Abs() <= o.skewAllowance {
+		return 0
+	}
+	return m.skew
+}
+
+// measureClockSkew writes a probe file to dir and compares its modification time,
+// set by the filesystem, with the local time it was written at.
+func measureClockSkew(dir string) (time.Duration, error) {
+	before := time.Now()
+	probe, err := os.CreateTemp(dir, ".clock-probe-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(probe.Name())
+
+	if _, err := probe.Write([]byte{0}); err != nil {
+		probe.Close()
+		return 0, err
+	}
+	if err := probe.Close(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(probe.Name())
+	if err != nil {
+		return 0, err
+	}
+	after := time.Now()
+
+	local := before.Add(after.Sub(before) / 2)
+	return info.ModTime().Sub(local), nil
+}
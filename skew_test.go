@@ -0,0 +1,129 @@
+package get_with_cache_go
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// injectSkew records a measurement of the filesystem clock of dir, taken at measuredAt.
+func injectSkew(t *testing.T, dir string, skew time.Duration, measuredAt time.Time) {
+	t.Helper()
+	skewMeasurements.Lock()
+	skewMeasurements.dirs[dir] = skewMeasurement{skew: skew, measuredAt: measuredAt}
+	skewMeasurements.Unlock()
+	t.Cleanup(func() {
+		skewMeasurements.Lock()
+		delete(skewMeasurements.dirs, dir)
+		skewMeasurements.Unlock()
+	})
+}
+
+func TestClockSkewFreshness(t *testing.T) {
+	dir := t.TempDir()
+	// The filesystem clock is an hour behind the local one
+	injectSkew(t, dir, -time.Hour, time.Now())
+	path := entryPath(dir, "key", newOptions(nil))
+	if err := writeFileAtomic(path, []byte(`1`)); err != nil {
+		t.Fatal(err)
+	}
+	written := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, written, written); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		fresh bool
+	}{
+		{"skew tolerated", []Option{WithClockSkewAllowance(time.Minute)}, true},
+		{"skew within allowance", []Option{WithClockSkewAllowance(2 * time.Hour)}, false},
+		{"no allowance", nil, false},
+	}
+	for _, tt := range tests {
+		info, err := statEntry(path, newOptions(tt.opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh := isFresh(info, 10*time.Minute); fresh != tt.fresh {
+			t.Errorf("%s: fresh %v, want %v (age %s)", tt.name, fresh, tt.fresh, entryAge(info))
+		}
+
+		calls := 0
+		got, err := FetchDataWithCache(func() (int, error) { calls++; return 2, nil }, "key", dir,
+			append(tt.opts, WithTTL(10*time.Minute))...)
+		if err != nil || (got == 1) != tt.fresh {
+			t.Errorf("%s: got %d, %v after %d calls", tt.name, got, err, calls)
+		}
+		if err := writeFileAtomic(path, []byte(`1`)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, written, written); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClockSkewTouchEntry(t *testing.T) {
+	dir := t.TempDir()
+	injectSkew(t, dir, -time.Hour, time.Now())
+	o := newOptions([]Option{WithClockSkewAllowance(time.Minute)})
+	path := entryPath(dir, "key", o)
+	if err := writeFileAtomic(path, []byte(`1`)); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-3 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := touchEntry(path, o); err != nil {
+		t.Fatal(err)
+	}
+	// Touched on the filesystem clock, so that other hosts see the entry as just written
+	raw, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := time.Since(raw.ModTime()) - time.Hour; age.Abs() > time.Minute {
+		t.Errorf("modification time %s not on the filesystem clock", raw.ModTime())
+	}
+	info, err := statEntry(path, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := entryAge(info); age.Abs() > time.Minute {
+		t.Errorf("touched entry is %s old", age)
+	}
+}
+
+func TestClockSkewStats(t *testing.T) {
+	dir := t.TempDir()
+	o := newOptions([]Option{WithClockSkewAllowance(time.Minute)})
+	stats.clockSkew.Store(int64(time.Hour))
+
+	// A recent measurement is reused without measuring again
+	injectSkew(t, dir, 2*time.Hour, time.Now())
+	before := GetStats()
+	if skew := o.clockSkew(dir); skew != 2*time.Hour {
+		t.Fatalf("got skew %s", skew)
+	}
+	if after := GetStats(); after.ClockSkew != before.ClockSkew || after.ClockSkewDetections != before.ClockSkewDetections {
+		t.Errorf("stats changed from %+v to %+v without measuring", before, after)
+	}
+
+	// An outdated one is replaced by a new measurement, which finds the local filesystem in sync
+	injectSkew(t, dir, 2*time.Hour, time.Now().Add(-2*skewMeasurementTTL))
+	if skew := o.clockSkew(dir); skew != 0 {
+		t.Fatalf("got skew %s after measuring again", skew)
+	}
+	after := GetStats()
+	if after.ClockSkew.Abs() > time.Second || after.ClockSkewDetections != before.ClockSkewDetections {
+		t.Errorf("stats changed from %+v to %+v", before, after)
+	}
+	if probes, _ := filepath.Glob(filepath.Join(dir, ".clock-probe-*")); len(probes) != 0 {
+		t.Errorf("probe files left behind: %v", probes)
+	}
+}
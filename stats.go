@@ -0,0 +1,59 @@
+package get_with_cache_go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of counters collected by all caches of the process.
+type Stats struct {
+	// ScrubbedEntries is the number of entries verified by the scrubber.
+	ScrubbedEntries uint64
+	// CorruptEntries is the number of entries the scrubber found corrupt.
+	CorruptEntries uint64
+	// QuarantinedEntries is the number of corrupt entries moved to quarantine.
+	QuarantinedEntries uint64
+	// ClockSkew is the last measured offset of a cache directory's filesystem clock from the local clock.
+	ClockSkew time.Duration
+	// ClockSkewDetections is the number of measurements in which the offset exceeded the allowance.
+	ClockSkewDetections uint64
+	// ShadowFetches is the number of background fetches made by WithShadowFetch.
+	ShadowFetches uint64
+	// ShadowDivergences is the number of shadow fetches whose result differed from the cached entry.
+	ShadowDivergences uint64
+	// ShadowErrors is the number of shadow fetches that failed.
+	ShadowErrors uint64
+	// ShadowDrops is the number of sampled cache hits not fetched because too many shadow fetches were running.
+	ShadowDrops uint64
+}
+
+var stats struct {
+	scrubbedEntries    atomic.Uint64
+	corruptEntries     atomic.Uint64
+	quarantinedEntries atomic.Uint64
+
+	clockSkew           atomic.Int64
+	clockSkewDetections atomic.Uint64
+
+	shadowFetches     atomic.Uint64
+	shadowDivergences atomic.Uint64
+	shadowErrors      atomic.Uint64
+	shadowDrops       atomic.Uint64
+}
+
+// GetStats returns the current counters.
+func GetStats() Stats {
+	return Stats{
+		ScrubbedEntries:    stats.scrubbedEntries.Load(),
+		CorruptEntries:     stats.corruptEntries.Load(),
+		QuarantinedEntries: stats.quarantinedEntries.Load(),
+
+		ClockSkew:           time.Duration(stats.clockSkew.Load()),
+		ClockSkewDetections: stats.clockSkewDetections.Load(),
+
+		ShadowFetches:     stats.shadowFetches.Load(),
+		ShadowDivergences: stats.shadowDivergences.Load(),
+		ShadowErrors:      stats.shadowErrors.Load(),
+		ShadowDrops:       stats.shadowDrops.Load(),
+	}
+}
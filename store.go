@@ -0,0 +1,298 @@
+package get_with_cache_go
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entryPath returns the path of the cache file for cacheKey within cacheDir.
+func entryPath(cacheDir string, cacheKey string, o *options) string {
+	name := cacheKey
+	if o.privateKeys != nil {
+		name = o.privateKeys.fileName(cacheKey)
+	}
+	return filepath.Join(entryDir(cacheDir, o), name+".json")
+}
+
+// entryDir returns the directory holding the entries of the namespace and schema version of o.
+// Schema versions other than 0 have a subdirectory of the namespace, which cannot collide with a
+// namespace as those may not start with "@".
+func entryDir(cacheDir string, o *options) string {
+	if o.schemaVersion != 0 {
+		return filepath.Join(cacheDir, o.namespace, schemaDir(o.schemaVersion))
+	}
+	return filepath.Join(cacheDir, o.namespace)
+}
+
+// schemaDir returns the name of the subdirectory of entries with schema version.
+func schemaDir(version int) string {
+	return "@v" + strconv.Itoa(version)
+}
+
+// isSchemaDir reports whether name is the name of a schema version subdirectory.
+func isSchemaDir(name string) bool {
+	version, ok := strings.CutPrefix(name, "@v")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(version)
+	return err == nil
+}
+
+// inSubdirectory reports whether the entries of o are stored below the cache directory,
+// whose directories are created on demand.
+func (o *options) inSubdirectory() bool {
+	return o.namespace != "" || o.schemaVersion != 0
+}
+
+// statEntry returns the file info of the entry at path, whether it is stored as a single file
+// or in chunks. For chunked entries the info of the manifest is returned. With WithClockSkewAllowance
+// the modification time is translated from the filesystem clock to the local clock.
+func statEntry(path string, o *options) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		info, err = os.Stat(manifestPath(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if skew := o.clockSkew(filepath.Dir(path)); skew != 0 {
+		return skewedFileInfo{FileInfo: info, skew: skew}, nil
+	}
+	return info, nil
+}
+
+// entryAge returns how long ago the entry described by info was written.
+func entryAge(info os.FileInfo) time.Duration {
+	return time.Since(info.ModTime())
+}
+
+// isFresh reports whether the entry described by info is younger than ttl. A ttl of 0 never expires.
+func isFresh(info os.FileInfo, ttl time.Duration) bool {
+	return ttl <= 0 || entryAge(info) <= ttl
+}
+
+// touchEntry sets the modification time of the entry at path to now, restarting its TTL.
+func touchEntry(path string, o *options) error {
+	now := time.Now().Add(o.clockSkew(filepath.Dir(path)))
+	err := os.Chtimes(path, now, now)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Chtimes(manifestPath(path), now, now)
+}
+
+// maxEntryReadAttempts limits how often reading a chunked entry is retried when the entry
+// is rewritten while it is read.
+const maxEntryReadAttempts = 3
+
+// readEntry reads the whole payload of the entry at path.
+func readEntry(path string) ([]byte, error) {
+	return readEntryRange(path, 0, math.MaxInt64)
+}
+
+// readEntryRange reads up to length bytes of the payload of the entry at path, starting at offset.
+// If reading a chunked entry fails because a new version replaced it meanwhile, the read is
+// retried with the new version.
+func readEntryRange(path string, offset int64, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+
+	var err error
+	for attempt := 0; attempt < maxEntryReadAttempts; attempt++ {
+		var data []byte
+		var m *chunkManifest
+		data, m, err = readEntryRangeOnce(path, offset, length)
+		if err == nil || m == nil {
+			return data, err
+		}
+		if current, mErr := readManifest(path); mErr == nil && current.Generation == m.Generation {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// readEntryRangeOnce reads a range of the payload of the entry at path. For chunked entries
+// the manifest used is returned, also when reading the chunks failed.
+func readEntryRangeOnce(path string, offset int64, length int64) ([]byte, *chunkManifest, error) {
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		length = clampRange(info.Size(), offset, length)
+		buf := make([]byte, length)
+		if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, err
+		}
+		return buf, nil, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	m, err := readManifest(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := readChunks(path, m, offset, clampRange(m.Size, offset, length))
+	return data, m, err
+}
+
+// clampRange limits length so that the range starting at offset does not exceed size.
+func clampRange(size int64, offset int64, length int64) int64 {
+	if offset >= size {
+		return 0
+	}
+	return min(length, size-offset)
+}
+
+// writeEntry stores data as the payload of the entry for cacheKey at path, splitting it into chunks
+// when it exceeds the configured chunk size, and updates the declared indexes. Single-file payloads
+// get a checksum file next to them, chunked ones have theirs in the manifest. Data that cannot be
+// indexed is rejected before anything is written. The validator of the previous version is removed,
+// FetchDataWithRevalidation writes the one of the new version afterwards.
+func writeEntry(cacheKey string, path string, data []byte, o *options) error {
+	sum := sha256Hex(data)
+	built, err := buildIndexes(data, o.indexes)
+	if err != nil {
+		return fmt.Errorf("error building indexes: %w", err)
+	}
+	// Before the payload changes, so that the new payload is never revalidated with the old validator
+	if err := os.Remove(validatorPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if o.inSubdirectory() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	}
+
+	if o.chunkSize > 0 && int64(len(data)) > o.chunkSize {
+		if err := writeChunks(path, data, o.chunkSize); err != nil {
+			return err
+		}
+		// The manifest is in place, drop a previous single-file version of the entry
+		for _, file := range []string{path, checksumPath(path)} {
+			if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	} else {
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(checksumPath(path), []byte(sum)); err != nil {
+			return err
+		}
+		if err := removeChunks(path); err != nil {
+			return err
+		}
+	}
+
+	if err := writeIndexes(path, sum, built); err != nil {
+		return fmt.Errorf("error writing indexes: %w", err)
+	}
+	if o.privateKeys != nil {
+		if err := o.privateKeys.writeKeyFile(path, cacheKey); err != nil {
+			return fmt.Errorf("error writing key file: %w", err)
+		}
+	}
+	return nil
+}
+
+// entryFiles returns the paths of all files and directories making up the entry at path,
+// some of which may not exist.
+func entryFiles(path string) []string {
+	files := []string{path, checksumPath(path), manifestPath(path), chunkDir(path), keyPath(path), validatorPath(path)}
+	indexes, _ := filepath.Glob(indexPath(path, "*"))
+	return append(files, indexes...)
+}
+
+// checksumPath returns the path of the file holding the hex encoded SHA-256 of a single-file payload.
+func checksumPath(path string) string {
+	return path + ".sha256"
+}
+
+// removeEntry deletes all files of the entry at path.
+func removeEntry(path string) error {
+	for _, file := range entryFiles(path) {
+		if err := os.RemoveAll(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkEntries calls fn for every entry stored in cacheDir and its namespace subdirectories, with the
+// entry path, the path and info of the file describing the entry (the cache file or the manifest).
+// Files and directories whose name starts with a dot are internal and skipped.
+func walkEntries(cacheDir string, fn func(entry string, file string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != cacheDir && (strings.HasPrefix(d.Name(), ".") || strings.HasSuffix(d.Name(), ".chunks")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var entry string
+		switch {
+		case strings.HasPrefix(d.Name(), "."):
+			return nil
+		case strings.HasSuffix(d.Name(), ".json"):
+			entry = path
+		case strings.HasSuffix(d.Name(), ".json.manifest"):
+			entry = strings.TrimSuffix(path, ".manifest")
+		default:
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// Removed since listing the directory
+			return nil
+		}
+		return fn(entry, path, info)
+	})
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place,
+// so that readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
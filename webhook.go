@@ -0,0 +1,197 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookTimestampHeader carries the Unix time in seconds at which a webhook was signed.
+	WebhookTimestampHeader = "X-Cache-Timestamp"
+	// WebhookSignatureHeader carries "sha256=" followed by the hex encoded HMAC-SHA256
+	// of the timestamp, a dot and the request body.
+	WebhookSignatureHeader = "X-Cache-Signature"
+
+	defaultWebhookTolerance = 5 * time.Minute
+	maxWebhookBodySize      = 1 << 20
+)
+
+// WebhookRule maps webhook payloads to cache invalidations or refreshes.
+type WebhookRule struct {
+	// Event is matched against the "event" field of the JSON payload. An empty Event matches all payloads.
+	Event string
+	// Keys, if set, returns the cache keys affected by the payload.
+	Keys func(payload json.RawMessage) ([]string, error)
+	// Namespaces, if set, returns namespaces (see WithNamespace) to invalidate entirely.
+	Namespaces func(payload json.RawMessage) ([]string, error)
+	// Refresh, if set, is called for each affected key instead of invalidating it,
+	// e.g. with a FetchDataWithCacheContext call in CacheModeNoCache.
+	Refresh func(ctx context.Context, cacheKey string) error
+}
+
+// WebhookConfig configures NewWebhookHandler.
+type WebhookConfig struct {
+	// Secret is the key of the HMAC signatures.
+	Secret []byte
+	// Tolerance is how far the signed timestamp may be from the current time. Defaults to 5 minutes.
+	Tolerance time.Duration
+	Rules     []WebhookRule
+	// Options are used to locate entries, e.g. WithPrivateKeys or WithNamespace.
+	Options []Option
+}
+
+// NewWebhookHandler returns an http.Handler receiving signed webhooks from upstream systems and
+// applying the matching rules to the cache in `cacheDir`. Requests are rejected with 401 if their
+// signature does not verify or their timestamp is outside the tolerance, and with 409 if the same
+// signed request was already received, which protects against replays. Successfully applied
+// webhooks are answered with 204.
+func NewWebhookHandler(cacheDir string, cfg WebhookConfig) http.Handler {
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = defaultWebhookTolerance
+	}
+	return &webhookHandler{cacheDir: cacheDir, cfg: cfg, seen: map[string]time.Time{}}
+}
+
+type webhookHandler struct {
+	cacheDir string
+	cfg      WebhookConfig
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+
+	signedAt, mac, err := h.verify(r.Header.Get(WebhookTimestampHeader), r.Header.Get(WebhookSignatureHeader), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.firstSeen(mac, signedAt) {
+		http.Error(w, "webhook already received", http.StatusConflict)
+		return
+	}
+
+	var event struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "error parsing payload", http.StatusBadRequest)
+		return
+	}
+
+	for _, rule := range h.cfg.Rules {
+		if rule.Event != "" && rule.Event != event.Event {
+			continue
+		}
+		if err := h.apply(r.Context(), rule, body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify checks the signature of body and returns the signing time and the hex encoded MAC.
+// The MAC is returned in canonical form, as different encodings of the same signature, e.g. in
+// upper case, all verify.
+func (h *webhookHandler) verify(timestamp string, signature string, body []byte) (time.Time, string, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, "", errors.New("missing or invalid timestamp")
+	}
+	signedAt := time.Unix(seconds, 0)
+	if d := time.Since(signedAt); d > h.cfg.Tolerance || d < -h.cfg.Tolerance {
+		return time.Time{}, "", errors.New("timestamp outside tolerance")
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return time.Time{}, "", errors.New("missing or invalid signature")
+	}
+	mac := hmac.New(sha256.New, h.cfg.Secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return time.Time{}, "", errors.New("signature mismatch")
+	}
+	return signedAt, hex.EncodeToString(got), nil
+}
+
+// firstSeen records the MAC of a verified request and reports whether it was not seen before. MACs
+// are remembered until their timestamp falls out of the tolerance and they would be rejected anyway.
+func (h *webhookHandler) firstSeen(mac string, signedAt time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for seen, expiresAt := range h.seen {
+		if now.After(expiresAt) {
+			delete(h.seen, seen)
+		}
+	}
+	if _, ok := h.seen[mac]; ok {
+		return false
+	}
+	h.seen[mac] = signedAt.Add(h.cfg.Tolerance)
+	return true
+}
+
+func (h *webhookHandler) apply(ctx context.Context, rule WebhookRule, payload json.RawMessage) error {
+	if rule.Keys != nil {
+		keys, err := rule.Keys(payload)
+		if err != nil {
+			return fmt.Errorf("error mapping payload to keys: %w", err)
+		}
+		for _, cacheKey := range keys {
+			if rule.Refresh != nil {
+				err = rule.Refresh(ctx, cacheKey)
+			} else {
+				err = Invalidate(cacheKey, h.cacheDir, h.cfg.Options...)
+			}
+			if err != nil {
+				return fmt.Errorf("error updating cache entry %q: %w", cacheKey, err)
+			}
+		}
+	}
+
+	if rule.Namespaces != nil {
+		namespaces, err := rule.Namespaces(payload)
+		if err != nil {
+			return fmt.Errorf("error mapping payload to namespaces: %w", err)
+		}
+		for _, namespace := range namespaces {
+			// Never let a payload remove anything but a namespace directory
+			if err := validateNamespace(namespace); err != nil {
+				return err
+			}
+			if err := os.RemoveAll(filepath.Join(h.cacheDir, filepath.Clean(namespace))); err != nil {
+				return fmt.Errorf("error removing namespace %q: %w", namespace, err)
+			}
+		}
+	}
+	return nil
+}
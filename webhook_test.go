@@ -0,0 +1,163 @@
+package get_with_cache_go
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testWebhookSecret = []byte("webhook secret")
+
+func signedWebhook(t *testing.T, body string, signedAt time.Time, secret []byte) *http.Request {
+	t.Helper()
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + body))
+
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	r.Header.Set(WebhookTimestampHeader, timestamp)
+	r.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func newTestWebhookHandler(dir string) http.Handler {
+	return NewWebhookHandler(dir, WebhookConfig{
+		Secret: testWebhookSecret,
+		Rules: []WebhookRule{
+			{
+				Event: "updated",
+				Keys: func(payload json.RawMessage) ([]string, error) {
+					var p struct {
+						Key string `json:"key"`
+					}
+					err := json.Unmarshal(payload, &p)
+					return []string{p.Key}, err
+				},
+			},
+			{
+				Event: "purged",
+				Namespaces: func(payload json.RawMessage) ([]string, error) {
+					var p struct {
+						Namespace string `json:"namespace"`
+					}
+					err := json.Unmarshal(payload, &p)
+					return []string{p.Namespace}, err
+				},
+			},
+		},
+	})
+}
+
+func serveWebhook(h http.Handler, r *http.Request) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestWebhookInvalidatesKeys(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CompareAndSwap("a", dir, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestWebhookHandler(dir)
+
+	if code := serveWebhook(h, signedWebhook(t, `{"event":"updated","key":"a"}`, time.Now(), testWebhookSecret)); code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", code, http.StatusNoContent)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); !os.IsNotExist(err) {
+		t.Fatalf("entry not invalidated: %v", err)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestWebhookHandler(dir)
+	body := `{"event":"updated","key":"a"}`
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"wrong secret", signedWebhook(t, body, time.Now(), []byte("other secret"))},
+		{"expired", signedWebhook(t, body, time.Now().Add(-time.Hour), testWebhookSecret)},
+		{"from the future", signedWebhook(t, body, time.Now().Add(time.Hour), testWebhookSecret)},
+	}
+
+	tampered := signedWebhook(t, body, time.Now(), testWebhookSecret)
+	tampered.Body = http.NoBody
+	tests = append(tests, struct {
+		name string
+		req  *http.Request
+	}{"tampered body", tampered})
+
+	unsigned := signedWebhook(t, body, time.Now(), testWebhookSecret)
+	unsigned.Header.Del(WebhookSignatureHeader)
+	tests = append(tests, struct {
+		name string
+		req  *http.Request
+	}{"unsigned", unsigned})
+
+	for _, tt := range tests {
+		if code := serveWebhook(h, tt.req); code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestWebhookReplay(t *testing.T) {
+	h := newTestWebhookHandler(t.TempDir())
+	body := `{"event":"updated","key":"a"}`
+	signedAt := time.Now()
+
+	if code := serveWebhook(h, signedWebhook(t, body, signedAt, testWebhookSecret)); code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", code, http.StatusNoContent)
+	}
+	if code := serveWebhook(h, signedWebhook(t, body, signedAt, testWebhookSecret)); code != http.StatusConflict {
+		t.Fatalf("replay: got status %d, want %d", code, http.StatusConflict)
+	}
+
+	// The same signature in upper case hex is still a replay
+	r := signedWebhook(t, body, signedAt, testWebhookSecret)
+	r.Header.Set(WebhookSignatureHeader, "sha256="+strings.ToUpper(strings.TrimPrefix(r.Header.Get(WebhookSignatureHeader), "sha256=")))
+	if code := serveWebhook(h, r); code != http.StatusConflict {
+		t.Fatalf("replay in upper case: got status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestWebhookNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CompareAndSwap("a", dir, "", 1, WithNamespace("tenant")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompareAndSwap("b", dir, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestWebhookHandler(dir)
+
+	for _, namespace := range []string{"", ".", "tenant/..", "../outside", "/abs", ".leases", ".quarantine"} {
+		body, _ := json.Marshal(map[string]string{"event": "purged", "namespace": namespace})
+		if code := serveWebhook(h, signedWebhook(t, string(body), time.Now(), testWebhookSecret)); code != http.StatusInternalServerError {
+			t.Errorf("namespace %q: got status %d, want %d", namespace, code, http.StatusInternalServerError)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.json")); err != nil {
+		t.Fatalf("entry outside of the namespaces removed: %v", err)
+	}
+
+	body := `{"event":"purged","namespace":"tenant"}`
+	if code := serveWebhook(h, signedWebhook(t, body, time.Now(), testWebhookSecret)); code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", code, http.StatusNoContent)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tenant")); !os.IsNotExist(err) {
+		t.Fatalf("namespace not removed: %v", err)
+	}
+}
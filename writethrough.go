@@ -0,0 +1,66 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrAmbiguousWrite is wrapped by WriteFunc errors when it is unknown whether the upstream
+// write was applied, e.g. after a timeout.
+var ErrAmbiguousWrite = errors.New("ambiguous upstream write")
+
+// WriteFunc is a generic type for functions that write a value of type T to the source of truth
+// and return the value as stored there.
+type WriteFunc[T any] func(ctx context.Context, value T) (T, error)
+
+// WriteThrough calls `writeFunc` with `value` under the entry lock of `cacheKey` (see WithLocker)
+// and, if it succeeds, stores the returned value in the cache. If the write fails with an error
+// wrapping ErrAmbiguousWrite, context.DeadlineExceeded or context.Canceled, the cached entry may
+// no longer match the source of truth and is invalidated. Other errors leave the entry unchanged.
+func WriteThrough[T any](ctx context.Context, writeFunc WriteFunc[T], value T, cacheKey string, cacheDir string, opts ...Option) (T, error) {
+	o := newOptionsFor[T](opts)
+	if o.err != nil {
+		return value, o.err
+	}
+	cacheFilePath := entryPath(cacheDir, cacheKey, o)
+
+	unlock, err := lockEntry(ctx, cacheFilePath, o)
+	if err != nil {
+		return value, fmt.Errorf("error locking cache entry: %w", err)
+	}
+	defer unlock()
+
+	data, err := writeFunc(ctx, value)
+	if err != nil {
+		if errors.Is(err, ErrAmbiguousWrite) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			if removeErr := removeEntry(cacheFilePath); removeErr != nil {
+				return data, errors.Join(fmt.Errorf("error writing data: %w", err), fmt.Errorf("error removing cache entry: %w", removeErr))
+			}
+			o.untrackExpiry(cacheKey)
+		}
+		return data, fmt.Errorf("error writing data: %w", err)
+	}
+
+	// Values that must not be cached replace the cached entry by nothing
+	if !isCacheable(&data) {
+		if err := removeEntry(cacheFilePath); err != nil {
+			return data, fmt.Errorf("error removing cache entry: %w", err)
+		}
+		o.untrackExpiry(cacheKey)
+		return data, nil
+	}
+
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return data, fmt.Errorf("error marshaling data to JSON: %w", err)
+	}
+
+	if err := writeEntry(cacheKey, cacheFilePath, dataBytes, o); err != nil {
+		return data, fmt.Errorf("error writing cache file: %w", err)
+	}
+	o.trackExpiry(cacheKey, cacheFilePath)
+
+	return data, nil
+}
@@ -0,0 +1,52 @@
+package get_with_cache_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWriteThrough(t *testing.T) {
+	dir := t.TempDir()
+	stored := func(_ context.Context, value int) (int, error) { return value * 10, nil }
+	if got, err := WriteThrough(context.Background(), stored, 1, "key", dir); err != nil || got != 10 {
+		t.Fatalf("got %d, %v", got, err)
+	}
+	// The value as returned by the source of truth is cached
+	if cached, _, err := ReadWithVersion[int]("key", dir); err != nil || cached != 10 {
+		t.Fatalf("cached %d, %v", cached, err)
+	}
+}
+
+func TestWriteThroughFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		invalidated bool
+	}{
+		{"ambiguous", fmt.Errorf("timeout: %w", ErrAmbiguousWrite), true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", fmt.Errorf("aborted: %w", context.Canceled), true},
+		{"rejected", errors.New("conflict"), false},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if _, err := CompareAndSwap("key", dir, "", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		failing := func(context.Context, int) (int, error) { return 0, tt.err }
+		if _, err := WriteThrough(context.Background(), failing, 2, "key", dir); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+
+		cached, _, err := ReadWithVersion[int]("key", dir)
+		if invalidated := errors.Is(err, ErrNotCached); invalidated != tt.invalidated {
+			t.Errorf("%s: got %d, %v, invalidated %v, want %v", tt.name, cached, err, invalidated, tt.invalidated)
+		}
+		if !tt.invalidated && cached != 1 {
+			t.Errorf("%s: cached %d, want the unchanged entry", tt.name, cached)
+		}
+	}
+}